@@ -1,136 +1,338 @@
-package phly
-
-// Support for phly-based applications
-
-import (
-	"fmt"
-	"github.com/micro-go/parse"
-	"os"
-	"os/signal"
-	"sort"
-	"syscall"
-	//	"time"
-)
-
-func RunApp() (Pins, error) {
-	filename, clas, err := readCla(os.Args)
-	if err != nil {
-		return nil, err
-	}
-	if filename == "" {
-		return nil, nil
-	}
-	return runPipeline(filename, clas)
-}
-
-func runPipeline(filename string, clas map[string]string) (Pins, error) {
-	p, err := LoadPipeline(filename)
-	if err != nil {
-		return nil, err
-	}
-	go func() {
-		finished := make(chan os.Signal, 1)
-		//		fmt.Println("signal")
-		signal.Notify(finished, os.Interrupt, syscall.SIGTERM)
-		//		fmt.Println("wait")
-		<-finished
-		//		fmt.Println("done 1")
-		p.Stop()
-		//		fmt.Println("done 2")
-		//		time.Sleep(1000 * time.Millisecond)
-		//		fmt.Println("done sleeping")
-	}()
-
-	// XXX Need to figure out how I get output back from the pin sender.
-	args := StartArgs{Cla: clas}
-	input := &pins{}
-	output := &pins{}
-	err = p.Run(args, input)
-	return output, err
-}
-
-func readCla(args []string) (string, map[string]string, error) {
-	clas := make(map[string]string)
-	token := parse.NewStringToken(args...)
-	// Skip the app name
-	token.Next()
-	filename := ""
-	for cur, err := token.Next(); err == nil; cur, err = token.Next() {
-		// Handle commands
-		switch cur {
-		case "-vars":
-			describeVars()
-			return "", nil, nil
-		case "-nodes":
-			describeNodes()
-			return "", nil, nil
-		case "-markdown":
-			markdownNodes()
-			return "", nil, nil
-		case "-dryrun":
-			//			dryrun = true
-			continue
-		}
-		// First token is the file
-		if filename == "" {
-			filename = cur
-		} else {
-			// All either args are CLA key / value pairs
-			nxt, err := token.Next()
-			if err != nil {
-				return "", nil, err
-			}
-			clas[cur] = nxt
-		}
-	}
-	// Default. Primarily for testing. Should probably make this configurable.
-	if filename == "" {
-		filename = `scaleimg.json`
-		//		filename = `run.json`
-	}
-	return filename, clas, nil
-}
-
-func describeVars() {
-	for _, v := range vardescrs {
-		fmt.Println(v.name, "-", v.descr)
-	}
-}
-
-func describeNodes() {
-	for _, v := range sortedNodes() {
-		descr := v.Describe()
-		fmt.Println(descr.ClaString())
-	}
-}
-
-func markdownNodes() {
-	for _, v := range sortedNodes() {
-		descr := v.Describe()
-		fmt.Println(descr.MarkdownString())
-	}
-}
-
-// --------------------------------
-// SORT
-
-func sortedNodes() []NodeFactory {
-	var nodes []NodeFactory
-	for _, v := range reg.factories {
-		nodes = append(nodes, v)
-	}
-	sort.Sort(SortNodeFactory(nodes))
-	return nodes
-}
-
-type SortNodeFactory []NodeFactory
-
-func (s SortNodeFactory) Len() int {
-	return len(s)
-}
-func (s SortNodeFactory) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
-}
-func (s SortNodeFactory) Less(i, j int) bool {
-	return s[i].Describe().Id < s[j].Describe().Id
-}
+package phly
+
+// Support for phly-based applications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/micro-go/lock"
+	"github.com/micro-go/parse"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RunApp() runs the pipeline named on the command line, answering
+// the pipeline output. When the -json flag is set, the output is
+// also written to stdout.
+func RunApp() (Pins, error) {
+	cla, err := readCla(os.Args)
+	if err != nil {
+		return nil, err
+	}
+	if cla.filename == "" && cla.resume == "" {
+		return nil, nil
+	}
+	if cla.validate {
+		return nil, validateApp(os.Stdout, cla.filename)
+	}
+	output, err := runPipeline(cla)
+	if err != nil {
+		return output, err
+	}
+	if cla.json {
+		err = writeJsonOutput(os.Stdout, output)
+	}
+	return output, err
+}
+
+func runPipeline(cla app_cla) (Pins, error) {
+	args := StartArgs{Cla: cla.clas}
+	if cla.resume != "" {
+		c, err := LoadCheckpoint(cla.resume)
+		if err != nil {
+			return nil, err
+		}
+		cla = cla.resumeFrom(c)
+		args.Cla = cla.clas
+		args.Resume = c
+	}
+	p, err := LoadPipeline(cla.filename)
+	if err != nil {
+		return nil, err
+	}
+	interrupted := lock.NewAtomicBool()
+	go func() {
+		finished := make(chan os.Signal, 1)
+		//		fmt.Println("signal")
+		signal.Notify(finished, os.Interrupt, syscall.SIGTERM)
+		//		fmt.Println("wait")
+		<-finished
+		//		fmt.Println("done 1")
+		interrupted.SetTo(true)
+		if cla.checkpoint != "" {
+			saveCheckpoint(p, cla.checkpoint)
+		}
+		p.Stop()
+		//		fmt.Println("done 2")
+		//		time.Sleep(1000 * time.Millisecond)
+		//		fmt.Println("done sleeping")
+	}()
+
+	defer watchPauseSignal(p)()
+	if cla.checkpoint != "" {
+		defer watchCheckpoints(p, cla.checkpoint)()
+	}
+
+	if cla.trace {
+		args.Tracer = NewJsonTracer(os.Stderr)
+	}
+	input := &pins{}
+	args.DryRun = cla.dryRun
+	output, err := p.Run(context.Background(), args, input)
+	if cla.dryRun && err == nil {
+		err = writePlan(os.Stdout, p.Plan())
+	}
+	if cla.report != "" {
+		err = MergeErrors(err, writeReport(cla.report, p.Stats()))
+	}
+	// A finished run has nothing to resume.
+	if cla.checkpoint != "" && err == nil && !interrupted.IsTrue() {
+		os.Remove(cla.checkpoint)
+	}
+	return output, err
+}
+
+// watchCheckpoints() saves a checkpoint of the running pipeline to the
+// named file every checkpoint_interval, answering a func that stops watching.
+func watchCheckpoints(p Pipeline, filename string) func() {
+	ticker := time.NewTicker(checkpoint_interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				saveCheckpoint(p, filename)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// saveCheckpoint() saves a checkpoint of the running pipeline, reporting any error.
+func saveCheckpoint(p Pipeline, filename string) {
+	c, err := p.Checkpoint()
+	if err == nil {
+		err = SaveCheckpoint(filename, c)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "checkpoint error:", err)
+	}
+}
+
+// validateApp() writes every problem in the named pipeline, answering an
+// error if any of them are errors.
+func validateApp(w io.Writer, filename string) error {
+	problems, err := ValidatePipeline(filename)
+	if err != nil {
+		return err
+	}
+	errs := 0
+	for _, p := range problems {
+		fmt.Fprintln(w, p.String())
+		if !p.Warning {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return NewBadRequestError(filename + " has " + strconv.Itoa(errs) + " errors")
+	}
+	fmt.Fprintln(w, filename, "is valid")
+	return nil
+}
+
+// writeReport() writes the run stats to the named file as JSON.
+func writeReport(filename string, stats PipelineStats) error {
+	data, err := json.MarshalIndent(stats, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+func writePlan(w io.Writer, plan PipelinePlan) error {
+	data, err := json.MarshalIndent(plan, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func writeJsonOutput(w io.Writer, output Pins) error {
+	data, err := PinsToJson(output)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func readCla(args []string) (app_cla, error) {
+	ans := app_cla{clas: make(map[string]string)}
+	token := parse.NewStringToken(args...)
+	// Skip the app name
+	token.Next()
+	for cur, err := token.Next(); err == nil; cur, err = token.Next() {
+		// Handle commands
+		switch cur {
+		case "-vars":
+			describeVars()
+			return app_cla{}, nil
+		case "-nodes":
+			describeNodes()
+			return app_cla{}, nil
+		case "-markdown":
+			markdownNodes()
+			return app_cla{}, nil
+		case "-dryrun":
+			ans.dryRun = true
+			continue
+		case "-validate":
+			ans.validate = true
+			continue
+		case "-json":
+			ans.json = true
+			continue
+		case "-trace":
+			ans.trace = true
+			continue
+		case "-report":
+			ans.report, err = token.Next()
+			if err != nil {
+				return app_cla{}, NewBadRequestError("-report needs a file name")
+			}
+			continue
+		case "-checkpoint":
+			ans.checkpoint, err = token.Next()
+			if err != nil {
+				return app_cla{}, NewBadRequestError("-checkpoint needs a file name")
+			}
+			continue
+		case "-resume":
+			ans.resume, err = token.Next()
+			if err != nil {
+				return app_cla{}, NewBadRequestError("-resume needs a file name")
+			}
+			continue
+		}
+		// First token is the file
+		if ans.filename == "" {
+			ans.filename = cur
+		} else {
+			// All either args are CLA key / value pairs
+			nxt, err := token.Next()
+			if err != nil {
+				return app_cla{}, err
+			}
+			ans.clas[cur] = nxt
+		}
+	}
+	// Default. Primarily for testing. Should probably make this configurable.
+	// A resumed run uses the pipeline from the checkpoint.
+	if ans.filename == "" && ans.resume == "" {
+		ans.filename = `scaleimg.json`
+		//		filename = `run.json`
+	}
+	return ans, nil
+}
+
+// --------------------------------
+// APP-CLA
+
+// app_cla stores the parsed command line.
+type app_cla struct {
+	filename   string
+	clas       map[string]string // Pipeline args
+	json       bool              // Write the pipeline output to stdout as JSON
+	trace      bool              // Write trace events to stderr as JSON lines
+	report     string            // Write the run stats to this file as JSON
+	dryRun     bool              // Run without side effects and write the plan to stdout
+	validate   bool              // Write the problems in the pipeline instead of running it
+	checkpoint string            // Periodically save the run to this file
+	resume     string            // Resume the run saved in this file
+}
+
+// resumeFrom() answers my cla with anything missing filled in from
+// the checkpoint. Pipeline args on the command line take precedence.
+func (c app_cla) resumeFrom(cp *Checkpoint) app_cla {
+	if c.filename == "" {
+		c.filename = cp.Pipeline
+	}
+	if c.checkpoint == "" {
+		c.checkpoint = c.resume
+	}
+	clas := make(map[string]string)
+	for k, v := range cp.Cla {
+		clas[k] = v
+	}
+	for k, v := range c.clas {
+		clas[k] = v
+	}
+	c.clas = clas
+	return c
+}
+
+func describeVars() {
+	for _, v := range defaultEngine.vars() {
+		fmt.Println(v.name, "-", v.descr)
+	}
+}
+
+func describeNodes() {
+	for _, v := range sortedNodes() {
+		descr := v.Describe()
+		fmt.Println(descr.ClaString())
+	}
+}
+
+func markdownNodes() {
+	for _, v := range sortedNodes() {
+		descr := v.Describe()
+		fmt.Println(descr.MarkdownString())
+	}
+}
+
+// --------------------------------
+// SORT
+
+func sortedNodes() []NodeFactory {
+	nodes := defaultEngine.factories()
+	sort.Sort(SortNodeFactory(nodes))
+	return nodes
+}
+
+type SortNodeFactory []NodeFactory
+
+func (s SortNodeFactory) Len() int {
+	return len(s)
+}
+func (s SortNodeFactory) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s SortNodeFactory) Less(i, j int) bool {
+	return s[i].Describe().Id < s[j].Describe().Id
+}
+
+// --------------------------------
+// CONST and VAR
+
+const (
+	checkpoint_interval = 30 * time.Second
+)
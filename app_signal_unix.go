@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+package phly
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchPauseSignal() toggles pausing the pipeline on SIGUSR1,
+// answering a func that stops watching.
+func watchPauseSignal(p Pipeline) func() {
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sig, syscall.SIGUSR1)
+	go func() {
+		paused := false
+		for {
+			select {
+			case <-sig:
+				paused = !paused
+				if paused {
+					p.Pause()
+				} else {
+					p.Resume()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package phly
+
+// watchPauseSignal() does nothing on Windows, which has no SIGUSR1.
+func watchPauseSignal(p Pipeline) func() {
+	return func() {}
+}
@@ -0,0 +1,192 @@
+package phly
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+)
+
+// ----------------------------------------
+// CHECKPOINT
+
+// Checkpoint is the saved state of a running pipeline, used to resume
+// the run later with StartArgs.Resume. When resumed, stopped nodes don't
+// run again, and each pending node is restarted with its pending pins.
+// Work a node did that isn't captured by its pins is lost: A node that
+// was running when the checkpoint was taken starts over.
+type Checkpoint struct {
+	Pipeline string            // The pipeline file, if it was loaded from one
+	Cla      map[string]string // The command line arguments of the run
+	Stopped  []string          // Nodes that finished and weren't running again
+	Pending  map[string][]Pins // The input for each node, in the order it's processed
+	Output   Pins              // Everything sent to the pipeline's outs so far
+}
+
+// ReadCheckpoint() reads a checkpoint written by WriteCheckpoint().
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	src := checkpointio{}
+	err := json.NewDecoder(r).Decode(&src)
+	if err != nil {
+		return nil, NewParseError(err)
+	}
+	if src.Version != checkpoint_version {
+		return nil, NewBadRequestError("Unsupported checkpoint version")
+	}
+	c := &Checkpoint{Pipeline: src.Pipeline, Cla: src.Cla, Stopped: src.Stopped, Pending: make(map[string][]Pins)}
+	for name, all := range src.Pending {
+		for _, p := range all {
+			pins, err := p.toPins(true)
+			if err != nil {
+				return nil, err
+			}
+			c.Pending[name] = append(c.Pending[name], pins)
+		}
+	}
+	c.Output, err = src.Output.toPins(true)
+	return c, err
+}
+
+// LoadCheckpoint() reads the checkpoint from the named file.
+func LoadCheckpoint(filename string) (*Checkpoint, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCheckpoint(f)
+}
+
+// WriteCheckpoint() writes the checkpoint as JSON:
+//
+//	{
+//		"version": 2,
+//		"pipeline": "scaleimg.json",
+//		"cla": { "name": "value" },
+//		"stopped": [ "node" ],
+//		"pending": { "node": [ { "pin": [ doc ] } ] },
+//		"output": { "pin": [ doc ] }
+//	}
+//
+// Each entry in pending is one input for the node. Every doc is written
+// the same as PinsToJson(), except that each item is written with its
+// type, so it reads back the same. See encodeItem() for the encoding.
+func WriteCheckpoint(w io.Writer, c *Checkpoint) error {
+	if c == nil {
+		return NewMissingError("Checkpoint")
+	}
+	dst := checkpointio{Version: checkpoint_version, Pipeline: c.Pipeline, Cla: c.Cla, Stopped: c.Stopped, Pending: make(map[string][]pinsio)}
+	for name, all := range c.Pending {
+		dst.Pending[name] = []pinsio{}
+		for _, pins := range all {
+			dst.Pending[name] = append(dst.Pending[name], newPinsIo(pins, true))
+		}
+	}
+	dst.Output = newPinsIo(c.Output, true)
+	data, err := json.MarshalIndent(dst, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// SaveCheckpoint() writes the checkpoint to the named file. The file is
+// replaced only once the checkpoint is complete.
+func SaveCheckpoint(filename string, c *Checkpoint) error {
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = WriteCheckpoint(f, c)
+	err = MergeErrors(err, f.Close())
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// validate() answers an error if the checkpoint names nodes the pipeline doesn't have.
+func (c *Checkpoint) validate(p *pipeline) error {
+	for _, name := range c.Stopped {
+		if p.nodes[name] == nil {
+			return NewMissingError("Checkpoint node " + name)
+		}
+	}
+	for name := range c.Pending {
+		if p.nodes[name] == nil {
+			return NewMissingError("Checkpoint node " + name)
+		}
+	}
+	return nil
+}
+
+// skips() answers true if the node shouldn't receive its initial input
+// on resume, because it stopped or its input is pending.
+func (c *Checkpoint) skips(node string) bool {
+	if _, ok := c.Pending[node]; ok {
+		return true
+	}
+	for _, name := range c.Stopped {
+		if name == node {
+			return true
+		}
+	}
+	return false
+}
+
+// ----------------------------------------
+// CHECKPOINT-IO
+
+// checkpointio is the serialized form of a checkpoint.
+type checkpointio struct {
+	Version  int                 `json:"version"`
+	Pipeline string              `json:"pipeline,omitempty"`
+	Cla      map[string]string   `json:"cla,omitempty"`
+	Stopped  []string            `json:"stopped,omitempty"`
+	Pending  map[string][]pinsio `json:"pending,omitempty"`
+	Output   pinsio              `json:"output,omitempty"`
+}
+
+// ----------------------------------------
+// MISC
+
+// newCheckpoint() answers the checkpoint for the running state. It
+// must be called on the runner, when no node is busy.
+func newCheckpoint(r *pipeline_runner, state *pipeline_running_state) *Checkpoint {
+	c := &Checkpoint{Pipeline: r.p.file, Cla: r.pargs.cla, Pending: make(map[string][]Pins), Output: r.getOutput()}
+	for name := range state.stopped {
+		if state.nodes[name] == nil {
+			c.Stopped = append(c.Stopped, name)
+		}
+	}
+	sort.Strings(c.Stopped)
+	// A node that started is restarted with the startup pins it received,
+	// and one still starting with everything it received. A node replaced
+	// after an error restarts with its startup pins, if input is waiting.
+	for name, n := range state.nodes {
+		if n.stage == NodeStarting {
+			c.Pending[name] = append(c.Pending[name], n.starting.receivedPins())
+		} else {
+			c.Pending[name] = append(c.Pending[name], n.starting.startupPins())
+		}
+	}
+	for name, inbox := range r.router.inboxes {
+		if pending := inbox.pending(); len(pending) > 0 {
+			if restart, ok := state.restarts[name]; ok && state.nodes[name] == nil {
+				c.Pending[name] = append(c.Pending[name], restart)
+			}
+			c.Pending[name] = append(c.Pending[name], pending...)
+		}
+	}
+	return c
+}
+
+// ----------------------------------------
+// CONST and VAR
+
+const (
+	checkpoint_version = 2
+)
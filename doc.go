@@ -59,6 +59,23 @@ func (d *Doc) StringItem(index int) string {
 	return ""
 }
 
+// Copy() answers a copy of the doc that can be safely handed to
+// another consumer. See copyItem() for the rules on items.
+func (d *Doc) Copy() *Doc {
+	if d == nil {
+		return nil
+	}
+	dst := &Doc{MimeType: d.MimeType}
+	dst.Header.Values = copyItem(d.Header.Values)
+	if d.Items != nil {
+		dst.Items = make([]interface{}, len(d.Items))
+		for i, item := range d.Items {
+			dst.Items[i] = copyItem(item)
+		}
+	}
+	return dst
+}
+
 // ----------------------------------------
 // DOCS
 
@@ -135,6 +152,15 @@ func (d Docs) StringItem(index int) string {
 	return ""
 }
 
+// Copy() answers a copy of every doc.
+func (d Docs) Copy() *Docs {
+	ans := &Docs{}
+	for _, doc := range d.Docs {
+		ans.Docs = append(ans.Docs, doc.Copy())
+	}
+	return ans
+}
+
 // ----------------------------------------
 // HEADER
 
@@ -176,6 +202,36 @@ func (h *Header) SetString(path, value string) error {
 	return err
 }
 
+// ----------------------------------------
+// MISC
+
+// copyItem() answers a copy of a single item. Items that implement
+// ItemCopier copy themselves, the common container types are copied
+// deeply, and everything else is treated as an immutable value and shared.
+func copyItem(_i interface{}) interface{} {
+	switch i := _i.(type) {
+	case ItemCopier:
+		return i.CopyItem()
+	case map[string]interface{}:
+		dst := make(map[string]interface{}, len(i))
+		for k, v := range i {
+			dst[k] = copyItem(v)
+		}
+		return dst
+	case []interface{}:
+		dst := make([]interface{}, len(i))
+		for idx, v := range i {
+			dst[idx] = copyItem(v)
+		}
+		return dst
+	case []string:
+		return append([]string(nil), i...)
+	case []byte:
+		return append([]byte(nil), i...)
+	}
+	return _i
+}
+
 /*
 func NewDocOnStringItems(n ...string) *Doc {
 	doc := &Doc{}
@@ -0,0 +1,318 @@
+package phly
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// PinsToJson() answers the pins as JSON. Each pin name maps to its
+// list of docs, and each doc is written as its mime type, header and items.
+func PinsToJson(pins Pins) ([]byte, error) {
+	return json.Marshal(newPinsIo(pins, false))
+}
+
+// JsonToPins() answers the pins written by PinsToJson(). Items are
+// answered as they read from JSON, so numbers are float64.
+func JsonToPins(data []byte) (Pins, error) {
+	var src pinsio
+	err := json.Unmarshal(data, &src)
+	if err != nil {
+		return nil, NewParseError(err)
+	}
+	return src.toPins(false)
+}
+
+// --------------------------------
+// PINS-IO
+
+// pinsio is the serialized form of pins.
+type pinsio map[string][]docio
+
+// newPinsIo() answers the serialized form of the pins. When typed is
+// true, every item is written with its type, as in checkpoints.
+func newPinsIo(pins Pins, typed bool) pinsio {
+	all := make(pinsio)
+	if pins != nil {
+		pins.WalkPins(func(name string, docs Docs) {
+			var dst []docio
+			for _, d := range docs.Docs {
+				if d != nil {
+					dst = append(dst, newDocIo(d, typed))
+				}
+			}
+			all[name] = dst
+		})
+	}
+	return all
+}
+
+// toPins() answers the pins, reading items with their type if typed is true.
+func (p pinsio) toPins(typed bool) (Pins, error) {
+	ans := &pins{}
+	for name, docs := range p {
+		dst := &Docs{}
+		for _, d := range docs {
+			doc, err := d.toDoc(typed)
+			if err != nil {
+				return nil, err
+			}
+			dst.appendDoc(doc)
+		}
+		ans.addDocs(name, dst)
+	}
+	return ans, nil
+}
+
+// --------------------------------
+// DOC-IO
+
+// docio is the serialized form of a doc.
+type docio struct {
+	MimeType string        `json:"mimetype,omitempty"`
+	Header   interface{}   `json:"header,omitempty"`
+	Items    []interface{} `json:"items"`
+}
+
+func newDocIo(d *Doc, typed bool) docio {
+	if !typed {
+		items := d.Items
+		if items == nil {
+			items = []interface{}{}
+		}
+		return docio{d.MimeType, d.Header.Values, items}
+	}
+	items := make([]interface{}, 0, len(d.Items))
+	for _, item := range d.Items {
+		items = append(items, encodeItem(item))
+	}
+	var header interface{}
+	if d.Header.Values != nil {
+		header = encodeItem(d.Header.Values)
+	}
+	return docio{d.MimeType, header, items}
+}
+
+func (d docio) toDoc(typed bool) (*Doc, error) {
+	doc := &Doc{MimeType: d.MimeType}
+	if !typed {
+		doc.Header.Values = d.Header
+		for _, item := range d.Items {
+			doc.AppendItem(item)
+		}
+		return doc, nil
+	}
+	if d.Header != nil {
+		header, err := decodeItem(d.Header)
+		if err != nil {
+			return nil, err
+		}
+		doc.Header.Values = header
+	}
+	for _, v := range d.Items {
+		item, err := decodeItem(v)
+		if err != nil {
+			return nil, err
+		}
+		doc.AppendItem(item)
+	}
+	return doc, nil
+}
+
+// --------------------------------
+// ITEM ENCODING
+
+// encodeItem() answers the item in a form that can be written as JSON and
+// read back by decodeItem() as the same type. Every item is written as an
+// object with its type name and value, so no item can be mistaken for
+// another:
+//
+//	{ "type": "int", "value": "3" }
+//
+// The types are nil (no value), string, bool, float64, map and list, whose
+// values are themselves encoded, int, int32, int64, uint, uint32, uint64
+// and float32, []string, []byte (base64), time (RFC 3339) and duration
+// (nanoseconds). Integers are written as strings so no precision is lost.
+// Anything else is written as json, with encoding/json, and reads back as
+// plain JSON.
+func encodeItem(_i interface{}) interface{} {
+	switch i := _i.(type) {
+	case nil:
+		return typedItem{"nil", nil}
+	case string:
+		return typedItem{"string", i}
+	case bool:
+		return typedItem{"bool", i}
+	case float64:
+		return typedItem{"float64", i}
+	case map[string]interface{}:
+		dst := make(map[string]interface{}, len(i))
+		for k, v := range i {
+			dst[k] = encodeItem(v)
+		}
+		return typedItem{"map", dst}
+	case []interface{}:
+		dst := make([]interface{}, len(i))
+		for idx, v := range i {
+			dst[idx] = encodeItem(v)
+		}
+		return typedItem{"list", dst}
+	case int:
+		return typedItem{"int", strconv.FormatInt(int64(i), 10)}
+	case int32:
+		return typedItem{"int32", strconv.FormatInt(int64(i), 10)}
+	case int64:
+		return typedItem{"int64", strconv.FormatInt(i, 10)}
+	case uint:
+		return typedItem{"uint", strconv.FormatUint(uint64(i), 10)}
+	case uint32:
+		return typedItem{"uint32", strconv.FormatUint(uint64(i), 10)}
+	case uint64:
+		return typedItem{"uint64", strconv.FormatUint(i, 10)}
+	case float32:
+		return typedItem{"float32", float64(i)}
+	case []string:
+		return typedItem{"[]string", i}
+	case []byte:
+		return typedItem{"[]byte", base64.StdEncoding.EncodeToString(i)}
+	case time.Time:
+		return typedItem{"time", i.Format(time.RFC3339Nano)}
+	case time.Duration:
+		return typedItem{"duration", strconv.FormatInt(int64(i), 10)}
+	}
+	return typedItem{"json", _i}
+}
+
+// decodeItem() answers the item from a value written by encodeItem()
+// and read back as generic JSON.
+func decodeItem(v interface{}) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, NewBadRequestError("Untyped item")
+	}
+	t, ok := m["type"].(string)
+	if !ok {
+		return nil, NewBadRequestError("Untyped item")
+	}
+	return typedItem{t, m["value"]}.decode()
+}
+
+// --------------------------------
+// TYPED-ITEM
+
+// typedItem is the serialized form of a single item and its type.
+type typedItem struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func (t typedItem) decode() (interface{}, error) {
+	s, _ := t.Value.(string)
+	switch t.Type {
+	case "nil":
+		return nil, nil
+	case "string":
+		if _, ok := t.Value.(string); !ok {
+			return nil, t.check(BadRequestErr)
+		}
+		return s, nil
+	case "bool":
+		b, ok := t.Value.(bool)
+		if !ok {
+			return nil, t.check(BadRequestErr)
+		}
+		return b, nil
+	case "float64":
+		f, ok := t.Value.(float64)
+		if !ok {
+			return nil, t.check(BadRequestErr)
+		}
+		return f, nil
+	case "map":
+		src, ok := t.Value.(map[string]interface{})
+		if !ok && t.Value != nil {
+			return nil, t.check(BadRequestErr)
+		}
+		dst := make(map[string]interface{}, len(src))
+		for k, v := range src {
+			item, err := decodeItem(v)
+			if err != nil {
+				return nil, err
+			}
+			dst[k] = item
+		}
+		return dst, nil
+	case "list":
+		src, ok := t.Value.([]interface{})
+		if !ok && t.Value != nil {
+			return nil, t.check(BadRequestErr)
+		}
+		dst := make([]interface{}, len(src))
+		for idx, v := range src {
+			item, err := decodeItem(v)
+			if err != nil {
+				return nil, err
+			}
+			dst[idx] = item
+		}
+		return dst, nil
+	case "json":
+		return t.Value, nil
+	case "int":
+		n, err := strconv.ParseInt(s, 10, 0)
+		return int(n), t.check(err)
+	case "int32":
+		n, err := strconv.ParseInt(s, 10, 32)
+		return int32(n), t.check(err)
+	case "int64":
+		n, err := strconv.ParseInt(s, 10, 64)
+		return n, t.check(err)
+	case "uint":
+		n, err := strconv.ParseUint(s, 10, 0)
+		return uint(n), t.check(err)
+	case "uint32":
+		n, err := strconv.ParseUint(s, 10, 32)
+		return uint32(n), t.check(err)
+	case "uint64":
+		n, err := strconv.ParseUint(s, 10, 64)
+		return n, t.check(err)
+	case "float32":
+		f, ok := t.Value.(float64)
+		if !ok {
+			return nil, t.check(BadRequestErr)
+		}
+		return float32(f), nil
+	case "[]string":
+		src, ok := t.Value.([]interface{})
+		if !ok && t.Value != nil {
+			return nil, t.check(BadRequestErr)
+		}
+		dst := make([]string, 0, len(src))
+		for _, v := range src {
+			vs, ok := v.(string)
+			if !ok {
+				return nil, t.check(BadRequestErr)
+			}
+			dst = append(dst, vs)
+		}
+		return dst, nil
+	case "[]byte":
+		b, err := base64.StdEncoding.DecodeString(s)
+		return b, t.check(err)
+	case "time":
+		tm, err := time.Parse(time.RFC3339Nano, s)
+		return tm, t.check(err)
+	case "duration":
+		n, err := strconv.ParseInt(s, 10, 64)
+		return time.Duration(n), t.check(err)
+	}
+	return nil, NewBadRequestError("Unknown item type " + t.Type)
+}
+
+func (t typedItem) check(err error) error {
+	if err != nil {
+		return NewBadRequestError("Invalid " + t.Type + " item")
+	}
+	return nil
+}
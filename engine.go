@@ -0,0 +1,162 @@
+package phly
+
+import (
+	"encoding/json"
+	"github.com/micro-go/lock"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// ----------------------------------------
+// ENGINE
+
+// Engine owns the nodes, environment and vars used to load and run
+// pipelines. Pipelines only see the nodes and vars of the engine that
+// loaded them, so several engines can run in one process without
+// sharing state. The package functions, such as Register() and
+// LoadPipeline(), use the default engine.
+type Engine struct {
+	mutex     sync.RWMutex
+	reg       *registry
+	env       *environment
+	vardescrs []varDescr
+	pids      lock.AtomicInt32 // Identifies each pipeline run in trace events
+}
+
+// NewEngine() answers an engine with the standard vars, the phlib folder
+// next to the executable, and the nodes built into phly.
+func NewEngine() *Engine {
+	e := &Engine{reg: newRegistry(), env: &environment{}, pids: lock.NewAtomicInt32()}
+	e.AddPhlibPath(factoryPhlibPath())
+	e.RegisterVar("cpus", "Number of CPUs", strconv.Itoa(runtime.NumCPU()))
+	e.RegisterVar("os", "OS name", runtime.GOOS)
+	e.RegisterVar("rndu", "Random unipolar number (0 to 1)", rndUnipolar)
+	e.RegisterVar("rndb", "Random bipolar number (-1 to 1)", rndBipolar)
+
+	// Register factory nodes
+	//	e.Register(&batch{})
+	//	e.Register(&console{})
+	//	e.Register(&files{})
+	//	e.Register(&filewatch{})
+	e.Register(&pipeline{})
+	return e
+}
+
+// DefaultEngine() answers the engine used by the package functions.
+func DefaultEngine() *Engine {
+	return defaultEngine
+}
+
+// Register() makes the node available to pipelines loaded by me.
+func (e *Engine) Register(fac NodeFactory) error {
+	defer lock.Write(&e.mutex).Unlock()
+	return e.reg.register(fac)
+}
+
+// RegisterVar() registers a variable with me. See the package RegisterVar().
+func (e *Engine) RegisterVar(name, descr string, optional_value interface{}) {
+	defer lock.Write(&e.mutex).Unlock()
+	e.vardescrs = append(e.vardescrs, varDescr{name, descr})
+	e.vardescrs = sortedVars(e.vardescrs)
+	if optional_value != nil {
+		e.env.setVar(name, optional_value)
+	}
+}
+
+// AddPhlibPath() adds a folder that is searched for pipeline files.
+func (e *Engine) AddPhlibPath(path string) {
+	e.env.addPhlibPath(path)
+}
+
+// Env() answers my environment.
+func (e *Engine) Env() Environment {
+	return e.env
+}
+
+// LoadPipeline() loads the pipeline from the named file,
+// searching my phlib paths if it isn't a path to a file.
+func (e *Engine) LoadPipeline(name string) (Pipeline, error) {
+	filename := e.env.FindFile(name)
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return e.ReadPipeline(f)
+}
+
+// ReadPipeline() reads the pipeline from r. The format comes from the
+// extension of r's name, if it has one, and is JSON otherwise.
+func (e *Engine) ReadPipeline(r io.Reader) (Pipeline, error) {
+	p := &pipeline{engine: e}
+	err := readPipeline(r, p)
+	return p, err
+}
+
+// ValidatePipeline() loads the named pipeline and answers every problem
+// in it, without running anything. The error is only for pipelines that
+// can't be read, such as a parse error or an unregistered node.
+func (e *Engine) ValidatePipeline(name string) ([]ValidateProblem, error) {
+	p, err := e.LoadPipeline(name)
+	if verr, ok := err.(*ValidateError); ok {
+		return verr.Problems, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return p.(*pipeline).problems(), nil
+}
+
+// instantiate() answers a new node for the registered id, with the cfg applied.
+func (e *Engine) instantiate(name string, cfg interface{}) (Node, error) {
+	fac, ok := e.factory(name)
+	if !ok {
+		return nil, NewMissingError("Node " + name)
+	}
+	args := InstantiateArgs{Env: e.env, engine: e}
+	n, err := fac.Instantiate(args, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// Default installation of settings. Nodes can use the standard
+	// json tagging to participate, or not to turn it off.
+	if cfg != nil {
+		b, err := json.Marshal(cfg)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(b, n)
+	}
+	return n, err
+}
+
+func (e *Engine) factory(name string) (NodeFactory, bool) {
+	defer lock.Read(&e.mutex).Unlock()
+	fac, ok := e.reg.factories[name]
+	return fac, ok
+}
+
+// factories() answers all my registered nodes.
+func (e *Engine) factories() []NodeFactory {
+	defer lock.Read(&e.mutex).Unlock()
+	var nodes []NodeFactory
+	for _, v := range e.reg.factories {
+		nodes = append(nodes, v)
+	}
+	return nodes
+}
+
+// vars() answers all my registered vars, sorted by name.
+func (e *Engine) vars() []varDescr {
+	defer lock.Read(&e.mutex).Unlock()
+	return append([]varDescr{}, e.vardescrs...)
+}
+
+// ----------------------------------------
+// CONST and VAR
+
+var (
+	defaultEngine = NewEngine()
+)
@@ -1,103 +1,166 @@
-package phly
-
-import (
-	"errors"
-	"strconv"
-)
-
-var (
-	BadRequestErr      = errors.New("Bad request")
-	emptyErr           = errors.New("Empty")
-	wrongFormatPinsErr = errors.New("Pins in the wrong format")
-)
-
-// --------------------------------
-// PHLY-ERROR
-
-func NewBadRequestError(msg string) error {
-	return &PhlyError{BadRequestErrCode, msg, nil}
-}
-
-func NewIllegalError(msg string) error {
-	return &PhlyError{IllegalErrCode, msg, nil}
-}
-
-func NewMissingError(msg string) error {
-	return &PhlyError{MissingErrCode, msg, nil}
-}
-
-func NewParseError(err error) error {
-	return &PhlyError{ParseErrCode, "", err}
-}
-
-type PhlyError struct {
-	code int
-	msg  string
-	err  error
-}
-
-func (e *PhlyError) ErrorCode() int {
-	return e.code
-}
-
-func (e *PhlyError) Error() string {
-	label := "Error"
-	switch e.code {
-	case BadRequestErrCode:
-		label = "Bad request"
-	case IllegalErrCode:
-		label = "Illegal"
-	case MissingErrCode:
-		label = "Missing"
-	case ParseErrCode:
-		label = "Parse"
-	}
-	label += " (" + strconv.Itoa(e.code) + ")"
-	if e.msg != "" {
-		label += ": " + e.msg
-	}
-	if e.err != nil {
-		label += ": " + e.err.Error()
-	}
-	return label
-}
-
-// --------------------------------
-// MISC
-
-// MergeErrors() answers the first non-nil error in the list.
-func MergeErrors(err ...error) error {
-	for _, a := range err {
-		if a != nil {
-			return a
-		}
-	}
-	return nil
-}
-
-// ErrorsEqual() returns true if the errors are equivalent.
-func ErrorsEqual(a, b error) bool {
-	if a == b {
-		return true
-	}
-	if a == nil || b == nil {
-		return false
-	}
-	// Our internal error class only needs to match to the type
-	aerr, aok := a.(*PhlyError)
-	berr, bok := b.(*PhlyError)
-	if aok && bok {
-		return aerr.code == berr.code
-	}
-	return a.Error() == b.Error()
-}
-
-// --------------------------------
-// CONST and VAR
-
-const (
-	BadRequestErrCode = 1000 + iota
-	IllegalErrCode
-	MissingErrCode
-	ParseErrCode
-)
+package phly
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	BadRequestErr      = errors.New("Bad request")
+	closedErr          = errors.New("Closed")
+	emptyErr           = errors.New("Empty")
+	wrongFormatPinsErr = errors.New("Pins in the wrong format")
+)
+
+// --------------------------------
+// PHLY-ERROR
+
+func NewBadRequestError(msg string) error {
+	return &PhlyError{BadRequestErrCode, msg, nil}
+}
+
+func NewIllegalError(msg string) error {
+	return &PhlyError{IllegalErrCode, msg, nil}
+}
+
+func NewMissingError(msg string) error {
+	return &PhlyError{MissingErrCode, msg, nil}
+}
+
+func NewParseError(err error) error {
+	return &PhlyError{ParseErrCode, "", err}
+}
+
+func NewOverflowError(msg string) error {
+	return &PhlyError{OverflowErrCode, msg, nil}
+}
+
+func NewMimeTypeError(msg string) error {
+	return &PhlyError{MimeTypeErrCode, msg, nil}
+}
+
+// NewPanicError() answers an error for a panic recovered from a node.
+// name and id are the node's name in the pipeline and registered id.
+func NewPanicError(name, id string, recovered interface{}, stack []byte) error {
+	msg := "Node " + name + " (" + id + "): " + fmt.Sprint(recovered) + "\n" + string(stack)
+	return &PhlyError{PanicErrCode, msg, nil}
+}
+
+type PhlyError struct {
+	code int
+	msg  string
+	err  error
+}
+
+func (e *PhlyError) ErrorCode() int {
+	return e.code
+}
+
+func (e *PhlyError) Error() string {
+	label := "Error"
+	switch e.code {
+	case BadRequestErrCode:
+		label = "Bad request"
+	case IllegalErrCode:
+		label = "Illegal"
+	case MissingErrCode:
+		label = "Missing"
+	case ParseErrCode:
+		label = "Parse"
+	case OverflowErrCode:
+		label = "Overflow"
+	case ProcessErrCode:
+		label = "Process"
+	case PanicErrCode:
+		label = "Panic"
+	case MimeTypeErrCode:
+		label = "MIME type"
+	}
+	label += " (" + strconv.Itoa(e.code) + ")"
+	if e.msg != "" {
+		label += ": " + e.msg
+	}
+	if e.err != nil {
+		label += ": " + e.err.Error()
+	}
+	return label
+}
+
+// Unwrap() answers the error I wrap, if any.
+func (e *PhlyError) Unwrap() error {
+	return e.err
+}
+
+// --------------------------------
+// PARSE-LOCATION-ERROR
+
+// ParseLocationError is a parse error at a line and column in a file,
+// both starting at 1. Col is 0 when the parser only reports the line.
+type ParseLocationError struct {
+	Line int
+	Col  int
+	Err  error
+}
+
+func (e *ParseLocationError) Error() string {
+	label := "line " + strconv.Itoa(e.Line)
+	if e.Col > 0 {
+		label += ", col " + strconv.Itoa(e.Col)
+	}
+	return label + ": " + e.Err.Error()
+}
+
+func (e *ParseLocationError) Unwrap() error {
+	return e.Err
+}
+
+// errorCoder is implemented by the errors in this package.
+type errorCoder interface {
+	ErrorCode() int
+}
+
+// --------------------------------
+// MISC
+
+// MergeErrors() answers the first non-nil error in the list.
+func MergeErrors(err ...error) error {
+	for _, a := range err {
+		if a != nil {
+			return a
+		}
+	}
+	return nil
+}
+
+// ErrorsEqual() returns true if the errors are equivalent.
+func ErrorsEqual(a, b error) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	// Our internal error classes only need to match to the type
+	aerr, aok := a.(errorCoder)
+	berr, bok := b.(errorCoder)
+	if aok && bok {
+		return aerr.ErrorCode() == berr.ErrorCode()
+	}
+	return a.Error() == b.Error()
+}
+
+// --------------------------------
+// CONST and VAR
+
+const (
+	BadRequestErrCode = 1000 + iota
+	IllegalErrCode
+	MissingErrCode
+	ParseErrCode
+	OverflowErrCode
+	ProcessErrCode
+	PanicErrCode
+	InvalidErrCode
+	MimeTypeErrCode
+)
@@ -1,18 +1,28 @@
-package phly
-
-import ()
-
-// ----------------------------------------
-// ITEMS
-
-// Items provides common behaviour on an
-// abstract collection.
-type Items interface {
-	// Get collections in various formats
-	AllItems() []interface{}
-	StringItems() []string
-
-	// Get at index in various formats
-	AllItem(index int) interface{}
-	StringItem(index int) string
-}
+package phly
+
+import ()
+
+// ----------------------------------------
+// ITEMS
+
+// Items provides common behaviour on an
+// abstract collection.
+type Items interface {
+	// Get collections in various formats
+	AllItems() []interface{}
+	StringItems() []string
+
+	// Get at index in various formats
+	AllItem(index int) interface{}
+	StringItem(index int) string
+}
+
+// ----------------------------------------
+// ITEM-COPIER
+
+// ItemCopier is implemented by mutable items. Any doc that is sent
+// to more than one destination is copied, and items that implement
+// this interface are responsible for answering their own copy.
+type ItemCopier interface {
+	CopyItem() interface{}
+}
@@ -1,26 +1,33 @@
-package phly
-
-const (
-	WhatPins     = "pins"
-	WhatStop     = "stop"
-	whatFlush    = "flush"
-	whatValidate = "validate"
-)
-
-// Msg is an abstract node message.
-type Msg struct {
-	What    string
-	Payload interface{}
-}
-
-func MsgFromPins(pins Pins) Msg {
-	return Msg{WhatPins, pins}
-}
-
-func MsgFromStop(err error) Msg {
-	return Msg{WhatStop, &StopPayload{err}}
-}
-
-type StopPayload struct {
-	Err error
-}
+package phly
+
+const (
+	WhatPins       = "pins"
+	WhatStop       = "stop"
+	whatValidate   = "validate"
+	whatInput      = "input"      // A node inbox has received input
+	whatError      = "error"      // A node output failed
+	whatStopped    = "stopped"    // A node has stopped
+	whatPause      = "pause"      // Pause the pipeline
+	whatResume     = "resume"     // Resume the pipeline
+	whatCheckpoint = "checkpoint" // Answer a checkpoint on the payload channel
+	whatWaiting    = "waiting"    // A node inside Process() is waiting on a full edge
+	whatWaited     = "waited"     // A node has stopped waiting on a full edge
+)
+
+// Msg is an abstract node message.
+type Msg struct {
+	What    string
+	Payload interface{}
+}
+
+func MsgFromPins(pins Pins) Msg {
+	return Msg{WhatPins, pins}
+}
+
+func MsgFromStop(err error) Msg {
+	return Msg{WhatStop, &StopPayload{err}}
+}
+
+type StopPayload struct {
+	Err error
+}
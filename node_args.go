@@ -1,68 +1,99 @@
-package phly
-
-import (
-	"path/filepath"
-)
-
-// ----------------------------------------
-// INSTANTIATE-ARGS
-
-// InstantiateArgs provides information during the instantiation phase.
-type InstantiateArgs struct {
-	Env Environment
-}
-
-// ----------------------------------------
-// PROCESS-ARGS
-
-// ProcessArgs provides arguments to the node during processing.
-type ProcessArgs struct {
-	//	Fields     map[string]interface{} // Unused?
-
-	env        Environment
-	dryRun     bool
-	workingdir string            // All relative file paths will use this as the root.
-	cla        map[string]string // Command line arguments
-	stop       chan struct{}
-}
-
-func (r *ProcessArgs) Env() Environment {
-	return r.env
-}
-
-// ClaValue() answers the command line argument value for the given name.
-func (r *ProcessArgs) ClaValue(name string) string {
-	if name == "" || r.cla == nil {
-		return ""
-	}
-	return r.cla[name]
-}
-
-// Filename() answers an absolute filename for the supplied filename.
-// Absolute filenames are returned as-is. Relative filenames are
-// made relative to the cfg that generated the pipeline.
-func (r *ProcessArgs) Filename(rel string) string {
-	if r.workingdir == "" {
-		return rel
-	}
-	if filepath.IsAbs(rel) {
-		return rel
-	}
-	abs, err := filepath.Abs(filepath.Join(r.workingdir, rel))
-	if err != nil {
-		return rel
-	}
-	return abs
-}
-
-func (r *ProcessArgs) copy() *ProcessArgs {
-	//	fields := make(map[string]interface{})
-	return &ProcessArgs{r.env, r.dryRun, r.workingdir, r.cla, r.stop}
-}
-
-// ----------------------------------------
-// STOPPED-ARGS
-
-// StoppedArgs provides information as nodes are stopping.
-type StoppedArgs struct {
-}
+package phly
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// ----------------------------------------
+// INSTANTIATE-ARGS
+
+// InstantiateArgs provides information during the instantiation phase.
+type InstantiateArgs struct {
+	Env    Environment
+	engine *Engine // Loads any pipelines the node needs
+}
+
+// ----------------------------------------
+// PROCESS-ARGS
+
+// ProcessArgs provides arguments to the node during processing.
+type ProcessArgs struct {
+	//	Fields     map[string]interface{} // Unused?
+
+	env        Environment
+	dryRun     bool
+	workingdir string            // All relative file paths will use this as the root.
+	cla        map[string]string // Command line arguments
+	ctx        context.Context
+	tracer     Tracer          // Handed to any nested pipelines
+	observer   *observer_queue // Shared with any nested pipelines, so events stay in order
+	node       string          // The name of the node receiving these args
+	plan       *run_plan
+	argValues  map[string]string // Values for the pipeline's args, set by the pipeline running it
+	argVars    []interface{}     // The pipeline's args as "${name}", value pairs, for the args of nested pipelines
+}
+
+func (r *ProcessArgs) Env() Environment {
+	return r.env
+}
+
+// Context() answers the context of the running pipeline. It is
+// cancelled when the pipeline stops, fails, or reaches its timeout.
+func (r *ProcessArgs) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// DryRun() answers true if nodes should report what they would do with
+// PlanAction() instead of doing it. Nodes without side effects can ignore it.
+func (r *ProcessArgs) DryRun() bool {
+	return r.dryRun
+}
+
+// PlanAction() adds a description of something the node would do to
+// the pipeline's plan. It is ignored unless this is a dry run.
+func (r *ProcessArgs) PlanAction(action string) {
+	if r.dryRun && r.plan != nil {
+		r.plan.add(r.node, action)
+	}
+}
+
+// ClaValue() answers the command line argument value for the given name.
+func (r *ProcessArgs) ClaValue(name string) string {
+	if name == "" || r.cla == nil {
+		return ""
+	}
+	return r.cla[name]
+}
+
+// Filename() answers an absolute filename for the supplied filename.
+// Absolute filenames are returned as-is. Relative filenames are
+// made relative to the cfg that generated the pipeline.
+func (r *ProcessArgs) Filename(rel string) string {
+	if r.workingdir == "" {
+		return rel
+	}
+	if filepath.IsAbs(rel) {
+		return rel
+	}
+	abs, err := filepath.Abs(filepath.Join(r.workingdir, rel))
+	if err != nil {
+		return rel
+	}
+	return abs
+}
+
+func (r *ProcessArgs) copy() *ProcessArgs {
+	//	fields := make(map[string]interface{})
+	return &ProcessArgs{r.env, r.dryRun, r.workingdir, r.cla, r.ctx, r.tracer, r.observer, r.node, r.plan, r.argValues, r.argVars}
+}
+
+// ----------------------------------------
+// STOPPED-ARGS
+
+// StoppedArgs provides information as nodes are stopping.
+type StoppedArgs struct {
+}
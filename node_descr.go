@@ -1,84 +1,174 @@
-package phly
-
-import ()
-
-// ----------------------------------------
-// NODE-DESCR
-
-// NodeDescr describes a node.
-type NodeDescr struct {
-	Id          string
-	Name        string
-	Purpose     string
-	Cfgs        []CfgDescr
-	StartupPins []PinDescr
-	InputPins   []PinDescr
-	OutputPins  []PinDescr
-}
-
-func (n *NodeDescr) FindInput(name string) *PinDescr {
-	return n.findPin(name, n.InputPins)
-}
-
-func (n *NodeDescr) FindOutput(name string) *PinDescr {
-	return n.findPin(name, n.OutputPins)
-}
-
-func (n *NodeDescr) findPin(name string, pins []PinDescr) *PinDescr {
-	for _, pin := range pins {
-		if pin.Name == name {
-			return &pin
-		}
-	}
-	return nil
-}
-
-func (n *NodeDescr) ClaString() string {
-	str := n.Name + " (" + n.Id + ")."
-	if n.Purpose != "" {
-		str += "\n" + n.Purpose
-	}
-	for _, descr := range n.Cfgs {
-		str += ("\n\tcfg \"" + descr.Name + "\". " + descr.Purpose)
-	}
-	for _, descr := range n.InputPins {
-		str += ("\n\tinput \"" + descr.Name + "\". " + descr.Purpose)
-	}
-	for _, descr := range n.OutputPins {
-		str += ("\n\toutput \"" + descr.Name + "\". " + descr.Purpose)
-	}
-	return str
-}
-
-func (n *NodeDescr) MarkdownString() string {
-	str := "* **" + n.Name + "** (" + n.Id + ")."
-	if n.Purpose != "" {
-		str += " " + n.Purpose
-	}
-	for _, descr := range n.Cfgs {
-		str += ("\n    * cfg **" + descr.Name + "**. " + descr.Purpose)
-	}
-	for _, descr := range n.InputPins {
-		str += ("\n    * input **" + descr.Name + "**. " + descr.Purpose)
-	}
-	for _, descr := range n.OutputPins {
-		str += ("\n    * output **" + descr.Name + "**. " + descr.Purpose)
-	}
-	return str
-}
-
-// --------------------------------
-// CFG-DESCR
-
-type CfgDescr struct {
-	Name    string
-	Purpose string
-}
-
-// --------------------------------
-// PIN-DESCR
-
-type PinDescr struct {
-	Name    string
-	Purpose string
-}
+package phly
+
+import (
+	"strings"
+)
+
+// ----------------------------------------
+// NODE-DESCR
+
+// NodeDescr describes a node.
+type NodeDescr struct {
+	Id          string
+	Name        string
+	Purpose     string
+	Cfgs        []CfgDescr
+	StartupPins []PinDescr
+	InputPins   []PinDescr
+	OutputPins  []PinDescr
+	Pausable    bool // The node receives the NodePausing and NodeResuming stages
+}
+
+func (n *NodeDescr) FindInput(name string) *PinDescr {
+	return n.findPin(name, n.InputPins)
+}
+
+func (n *NodeDescr) FindOutput(name string) *PinDescr {
+	return n.findPin(name, n.OutputPins)
+}
+
+func (n *NodeDescr) FindStartup(name string) *PinDescr {
+	return n.findPin(name, n.StartupPins)
+}
+
+func (n *NodeDescr) findPin(name string, pins []PinDescr) *PinDescr {
+	for _, pin := range pins {
+		if pin.Name == name {
+			return &pin
+		}
+	}
+	return nil
+}
+
+func (n *NodeDescr) ClaString() string {
+	str := n.Name + " (" + n.Id + ")."
+	if n.Purpose != "" {
+		str += "\n" + n.Purpose
+	}
+	for _, descr := range n.Cfgs {
+		str += ("\n\tcfg \"" + descr.Name + "\". " + descr.Purpose)
+	}
+	for _, descr := range n.StartupPins {
+		str += ("\n\tstartup \"" + descr.Name + "\"" + descr.optionalString() + descr.mimeTypesString() + ". " + descr.Purpose)
+	}
+	for _, descr := range n.InputPins {
+		str += ("\n\tinput \"" + descr.Name + "\"" + descr.mimeTypesString() + ". " + descr.Purpose)
+	}
+	for _, descr := range n.OutputPins {
+		str += ("\n\toutput \"" + descr.Name + "\"" + descr.mimeTypesString() + ". " + descr.Purpose)
+	}
+	return str
+}
+
+func (n *NodeDescr) MarkdownString() string {
+	str := "* **" + n.Name + "** (" + n.Id + ")."
+	if n.Purpose != "" {
+		str += " " + n.Purpose
+	}
+	for _, descr := range n.Cfgs {
+		str += ("\n    * cfg **" + descr.Name + "**. " + descr.Purpose)
+	}
+	for _, descr := range n.StartupPins {
+		str += ("\n    * startup **" + descr.Name + "**" + descr.optionalString() + descr.mimeTypesString() + ". " + descr.Purpose)
+	}
+	for _, descr := range n.InputPins {
+		str += ("\n    * input **" + descr.Name + "**" + descr.mimeTypesString() + ". " + descr.Purpose)
+	}
+	for _, descr := range n.OutputPins {
+		str += ("\n    * output **" + descr.Name + "**" + descr.mimeTypesString() + ". " + descr.Purpose)
+	}
+	return str
+}
+
+// --------------------------------
+// CFG-DESCR
+
+type CfgDescr struct {
+	Name    string
+	Purpose string
+}
+
+// --------------------------------
+// PIN-DESCR
+
+// PinDescr describes a single pin. Optional only applies to
+// startup pins: A node waits for data on every required startup pin
+// before it starts, but only waits for an optional startup pin when
+// something in the graph is connected to it.
+// MimeTypes are the types of doc an input pin accepts, or an output pin
+// produces, such as "text/plain" or "image/*". A pin with no types
+// accepts or produces anything, as does a doc with no MimeType.
+type PinDescr struct {
+	Name      string
+	Purpose   string
+	Optional  bool
+	MimeTypes []string
+}
+
+// Accepts() answers true if a doc with the MIME type can arrive on the pin.
+func (p PinDescr) Accepts(mimetype string) bool {
+	if len(p.MimeTypes) < 1 || mimetype == "" {
+		return true
+	}
+	for _, t := range p.MimeTypes {
+		if mimeTypesOverlap(t, mimetype) {
+			return true
+		}
+	}
+	return false
+}
+
+// compatible() answers true if any type I produce can be accepted by the input pin.
+func (p PinDescr) compatible(input PinDescr) bool {
+	if len(p.MimeTypes) < 1 {
+		return true
+	}
+	for _, t := range p.MimeTypes {
+		if input.Accepts(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p PinDescr) optionalString() string {
+	if p.Optional {
+		return " (optional)"
+	}
+	return ""
+}
+
+func (p PinDescr) mimeTypesString() string {
+	if len(p.MimeTypes) < 1 {
+		return ""
+	}
+	return " (" + strings.Join(p.MimeTypes, ", ") + ")"
+}
+
+// --------------------------------
+// MISC
+
+// mimeTypesOverlap() answers true if the MIME types can describe the same
+// doc. Either can be a wildcard, such as "image/*" or "*/*". Parameters,
+// such as "; charset=utf-8", and case are ignored.
+func mimeTypesOverlap(a, b string) bool {
+	atype, asub := splitMimeType(a)
+	btype, bsub := splitMimeType(b)
+	if atype != "*" && btype != "*" && atype != btype {
+		return false
+	}
+	return asub == "*" || bsub == "*" || asub == bsub
+}
+
+// splitMimeType() answers the type and subtype, where a
+// missing subtype is a wildcard.
+func splitMimeType(t string) (string, string) {
+	if i := strings.Index(t, ";"); i >= 0 {
+		t = t[:i]
+	}
+	parts := strings.SplitN(strings.ToLower(strings.TrimSpace(t)), "/", 2)
+	if len(parts) < 2 {
+		return parts[0], "*"
+	}
+	return parts[0], parts[1]
+}
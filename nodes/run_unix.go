@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package phly_nodes
+
+import (
+	"syscall"
+)
+
+// pause() suspends or continues the running command.
+func (r *run_func_t) pause(paused bool) error {
+	if r.cmd == nil || r.cmd.Process == nil || r.err.Get() != run_node_running {
+		return nil
+	}
+	sig := syscall.SIGCONT
+	if paused {
+		sig = syscall.SIGSTOP
+	}
+	return r.cmd.Process.Signal(sig)
+}
@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package phly_nodes
+
+// pause() is unsupported on Windows, which has no equivalent
+// to SIGSTOP, so the command keeps running while paused.
+func (r *run_func_t) pause(paused bool) error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package phly
+
+import (
+	"github.com/micro-go/lock"
+	"sync"
+)
+
+// ----------------------------------------
+// OBSERVER
+
+// Observer receives events as a pipeline runs, for applications that follow
+// along, such as a UI. Each event is the same one handed to the Tracer.
+// Events are delivered in order on a separate goroutine, so a slow observer
+// never blocks the runner, and PipelineFinished is always the last event.
+// Events from nested pipelines are delivered in the same order, with their
+// own Pipeline, but only the outermost pipeline sends PipelineFinished.
+type Observer interface {
+	NodeStarted(TraceEvent)
+	NodeStopped(TraceEvent)
+	PinsRouted(TraceEvent)
+	NodeError(TraceEvent)
+	PipelineFinished(TraceEvent)
+}
+
+// ----------------------------------------
+// OBSERVER-QUEUE
+
+// observer_queue buffers events for an observer, delivering them on
+// its own goroutine. The buffer is unbounded, since adding can't block.
+type observer_queue struct {
+	observer Observer
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	events   []TraceEvent
+	closed   bool // True once PipelineFinished has been added
+}
+
+// newObserverQueue() answers a queue for the observer, or nil if there's no observer.
+func newObserverQueue(o Observer) *observer_queue {
+	if o == nil {
+		return nil
+	}
+	q := &observer_queue{observer: o}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
+}
+
+// start() starts delivering events.
+func (q *observer_queue) start() {
+	if q != nil {
+		go q.deliver()
+	}
+}
+
+// add() adds the event, if it's one the observer receives.
+func (q *observer_queue) add(e TraceEvent) {
+	if q == nil {
+		return
+	}
+	switch e.What {
+	case TraceNodeStarted, TraceNodeStopped, TracePinsRouted, TraceError, TracePipelineFinished:
+	default:
+		return
+	}
+	defer lock.Locker(&q.mutex).Unlock()
+	if q.closed {
+		return
+	}
+	q.events = append(q.events, e)
+	q.closed = e.What == TracePipelineFinished
+	q.cond.Signal()
+}
+
+func (q *observer_queue) deliver() {
+	for {
+		events, closed := q.next()
+		for _, e := range events {
+			q.dispatch(e)
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// next() waits for events, answering them and true if there won't be any more.
+func (q *observer_queue) next() ([]TraceEvent, bool) {
+	defer lock.Locker(&q.mutex).Unlock()
+	for len(q.events) < 1 && !q.closed {
+		q.cond.Wait()
+	}
+	events := q.events
+	q.events = nil
+	return events, q.closed
+}
+
+func (q *observer_queue) dispatch(e TraceEvent) {
+	switch e.What {
+	case TraceNodeStarted:
+		q.observer.NodeStarted(e)
+	case TraceNodeStopped:
+		q.observer.NodeStopped(e)
+	case TracePinsRouted:
+		q.observer.PinsRouted(e)
+	case TraceError:
+		q.observer.NodeError(e)
+	case TracePipelineFinished:
+		q.observer.PipelineFinished(e)
+	}
+}
@@ -1,405 +1,458 @@
-package phly
-
-import (
-	"errors"
-	"fmt"
-	"github.com/micro-go/lock"
-	"github.com/micro-go/parse"
-	"io"
-	"os"
-	"strings"
-	"sync"
-)
-
-// --------------------------------
-// PIPELINE interface
-
-type Pipeline interface {
-	Run(args StartArgs, input Pins) error
-	Start(args StartArgs, input Pins) error
-	Stop() error
-	Wait() error
-}
-
-// --------------------------------
-// PIPELINE start
-
-// StartArgs provides arguments when starting the pipeline.
-type StartArgs struct {
-	Cla    map[string]string // Command line arguments
-	output NodeOutput        // The receiver for any output from this pipeline
-}
-
-// --------------------------------
-// PIPELINE struct
-
-type pipeline struct {
-	workingdir  string                `json:"-"`
-	args        pipeline_args         `json:"-"`
-	file        string                `json:"-"`
-	ins         []connection          `json:"-"`
-	nodes       map[string]*container `json:"-"`
-	inputDescr  []pipelinePinDescr    `json:"-"`
-	outputDescr []pipelinePinDescr    `json:"-"`
-	// running
-	mutex  sync.Mutex       `json:"-"`
-	runner *pipeline_runner `json:"-"`
-}
-
-func (p *pipeline) Describe() NodeDescr {
-	descr := NodeDescr{Id: "phly/pipeline", Name: "Pipeline", Purpose: "Run an internal pipeline."}
-	for _, pin := range p.inputDescr {
-		descr.InputPins = append(descr.InputPins, PinDescr{Name: pin.Name, Purpose: pin.Purpose})
-	}
-	for _, pin := range p.outputDescr {
-		descr.OutputPins = append(descr.OutputPins, PinDescr{Name: pin.Name, Purpose: pin.Purpose})
-	}
-	return descr
-}
-
-func (p *pipeline) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
-	ans := &pipeline{}
-	file, _ := parse.FindTreeString("file", cfg)
-	if file != "" {
-		ans.file = file
-		r := args.Env.FindReader(file)
-		if r == nil {
-			return nil, errors.New("Pipeline can't find " + file)
-		}
-		err := readPipeline(r, ans)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return ans, nil
-}
-
-func (p *pipeline) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
-	if stage == NodeStarting {
-		p.Stop()
-		// XXX I guess I need to cache the node output or something -- how do I get data out?
-		sargs := StartArgs{Cla: args.cla, output: output}
-		fmt.Println("PROCESS CALLING START")
-		return p.Start(sargs, input)
-	}
-	return nil
-}
-
-func (p *pipeline) StopNode(args StoppedArgs) error {
-	return p.Stop()
-}
-
-func (p *pipeline) Run(args StartArgs, input Pins) error {
-	err := p.Start(args, input)
-	if err != nil {
-		return err
-	}
-	return p.Wait()
-}
-
-func (p *pipeline) Start(args StartArgs, input Pins) error {
-	p.Stop()
-	pargs := ProcessArgs{env: env, workingdir: p.workingdir, cla: args.Cla}
-
-	defer lock.Locker(&p.mutex).Unlock()
-	runner, err := startPipelineRunner(p, args, pargs, input)
-	if err != nil {
-		return err
-	}
-	fmt.Println("pipeline started")
-	p.runner = runner
-	return nil
-}
-
-func (p *pipeline) Stop() error {
-	defer lock.Locker(&p.mutex).Unlock()
-
-	var err error
-	if p.runner != nil {
-		err = p.runner.close()
-		p.runner = nil
-	}
-	return err
-}
-
-func (p *pipeline) Wait() error {
-	r := p.getRunner()
-	if r == nil {
-		return NewIllegalError("Waiting but nothing started")
-	}
-	fmt.Println("START WAIT")
-	r.wait.Wait()
-	fmt.Println("STOP WAIT err", r.err.Get())
-	return r.err.Get()
-}
-
-// getRunner() answers the current runner, so we don't have
-// to keep a lock during the wait.
-func (p *pipeline) getRunner() *pipeline_runner {
-	defer lock.Locker(&p.mutex).Unlock()
-	return p.runner
-}
-
-// ResolveOutput() takes a source node name and pin and converts it into the
-// destination node name and pin.
-func (p *pipeline) ResolveOutput(srcnode, srcpin string) (string, string, error) {
-	c, ok := p.nodes[srcnode]
-	if c == nil || !ok {
-		return "", "", NewBadRequestError("Node " + srcnode + " does not exist")
-	}
-	for _, conn := range c.outputs {
-		if conn.srcPin == srcpin {
-			return conn.dstNode.name, conn.dstPin, nil
-		}
-	}
-	return "", "", NewBadRequestError("Node " + srcnode + " does not have pin " + srcpin)
-}
-
-func (p *pipeline) add(name string, n Node) error {
-	if p.nodes == nil {
-		p.nodes = make(map[string]*container)
-	}
-	_, ok := p.nodes[name]
-	if ok {
-		return NewIllegalError("Duplicate nodes named " + name)
-	}
-	p.nodes[name] = &container{name: name, node: n}
-	return nil
-}
-
-func (p *pipeline) addInput(srcpin string, dstnode *container, dstpin string) error {
-	if !(dstnode.name == args_container.name || dstnode.name == pipeline_container.name) {
-		return NewIllegalError("Invalid pin " + srcpin + " to " + dstnode.name + "->" + dstpin)
-	}
-	p.ins = append(p.ins, connection{srcpin, dstnode, dstpin})
-	return nil
-}
-
-// validate() verifies that the graph is valid.
-func (p *pipeline) validate() error {
-	descriptions := make(map[string]NodeDescr)
-	for _, n := range p.nodes {
-		descriptions[n.name] = n.node.Describe()
-	}
-
-	for _, n := range p.nodes {
-		for _, con := range n.inputs {
-			// Input that points to my hardcoded inputs have different rules
-			if con.dstNode != nil && (con.dstNode.name == args_container.name || con.dstNode.name == pipeline_container.name) {
-				continue
-			}
-
-			if con.dstNode == nil || con.dstNode.node == nil {
-				return errors.New("Node " + n.name + " has no destination for input pin " + con.srcPin)
-			}
-			// Input that points to the pipeline will be empty, so don't try to validate.
-			if con.dstNode.name != "" {
-				d, ok := descriptions[con.dstNode.name]
-				if !ok {
-					return errors.New("Node " + n.name + " has no description for input pin " + con.srcPin + " to " + con.dstNode.name)
-				}
-				pin := d.FindOutput(con.dstPin)
-				if pin == nil {
-					return errors.New("Node " + n.name + " has invalid input " + con.srcPin + " to " + con.dstNode.name + ":" + con.dstPin)
-				}
-			}
-		}
-		for _, con := range n.outputs {
-			if con.dstNode == nil || con.dstNode.node == nil {
-				return errors.New("Node " + n.name + " has no destination for output pin " + con.srcPin)
-			}
-			d, ok := descriptions[con.dstNode.name]
-			if !ok {
-				return errors.New("Node " + n.name + " has no description for output pin " + con.srcPin + " to " + con.dstNode.name)
-			}
-			pin := d.FindInput(con.dstPin)
-			if pin == nil {
-				return errors.New("Node " + n.name + " has invalid output " + con.srcPin + " to " + con.dstNode.name + ":" + con.dstPin)
-			}
-		}
-	}
-	return nil
-}
-
-// --------------------------------
-// PIPELINE-ARGS
-
-type arg_format string
-
-const (
-	empty_format  arg_format = ""
-	string_format arg_format = "string"
-)
-
-// pipeline_args provides a list of all pipeline args.
-type pipeline_args struct {
-	env  string
-	args map[string]pipeline_arg
-}
-
-func (p *pipeline_args) make(frmt arg_format, all map[string]interface{}) error {
-	if all == nil {
-		return nil
-	}
-	for k, _v := range all {
-		_, exists := p.arg(k)
-		if exists {
-			return errors.New("Duplicate arg: " + k)
-		}
-		switch v := _v.(type) {
-		case string:
-			p.setArg(k, string_format, v)
-		}
-	}
-	return nil
-}
-
-// valueDoc() answers a new doc on the given arg, resolving input sources.
-func (p *pipeline_args) valueDoc(args ProcessArgs, name string) *Doc {
-	a, ok := p.arg(name)
-	if !ok {
-		return nil
-	}
-	// Make env name
-	env_name := ""
-	if p.env != "" {
-		env_name = p.env + strings.ToUpper(name)
-	}
-	cla_name := name
-	return a.valueDoc(args, env_name, cla_name)
-}
-
-func (p *pipeline_args) arg(name string) (pipeline_arg, bool) {
-	if p.args == nil {
-		return pipeline_arg{}, false
-	}
-	ans, ok := p.args[name]
-	return ans, ok
-}
-
-func (p *pipeline_args) setArg(name string, format arg_format, value string) {
-	if p.args == nil {
-		p.args = make(map[string]pipeline_arg)
-	}
-	p.args[name] = pipeline_arg{format, value}
-}
-
-// --------------------------------
-// PIPELINE-ARG
-
-// pipeline_arg is a single argument into the pipeline.
-type pipeline_arg struct {
-	format arg_format
-	value  string
-}
-
-// valueDoc() answers a new doc on the given arg, resolving input sources.
-func (p pipeline_arg) valueDoc(args ProcessArgs, env_name, cla_name string) *Doc {
-	// Order of precedence: default value, environment variable, command line arg.
-	value := p.value
-	if env_name != "" {
-		if v, ok := os.LookupEnv(env_name); ok {
-			value = v
-		}
-	}
-	cla := args.ClaValue(cla_name)
-	if cla != "" {
-		value = cla
-	}
-
-	// Note: Currently ignoring the possibility of other types, since we only have string.
-	doc := &Doc{MimeType: texttype}
-	doc.AppendItem(value)
-	return doc
-}
-
-// --------------------------------
-// CONTAINER
-
-// container decorates a node with the input and output connections.
-type container struct {
-	name    string
-	node    Node
-	inputs  []connection
-	outputs []connection
-}
-
-var (
-	args_container     = &container{name: "args"}
-	pipeline_container = &container{name: ".pipeline"}
-)
-
-func (c *container) connect(srcpin string, dstnode *container, dstpin string) error {
-	if dstnode == nil || dstnode.node == nil {
-		return BadRequestErr
-	}
-	c.outputs = append(c.outputs, connection{srcpin, dstnode, dstpin})
-	dstnode.inputs = append(dstnode.inputs, connection{dstpin, c, srcpin})
-	return nil
-}
-
-// connectInput creates a one-way connection, for when we don't have the other node.
-func (c *container) connectInput(srcpin string, dstnode *container, dstpin string) error {
-	if dstnode == nil || dstnode.name == "" {
-		return BadRequestErr
-	}
-	c.inputs = append(c.inputs, connection{srcpin, dstnode, dstpin})
-	return nil
-}
-
-// close() closes the node, if possible.
-func (c *container) close() error {
-	if closer, ok := c.node.(io.Closer); ok && closer != nil {
-		return closer.Close()
-	}
-	return nil
-}
-
-// --------------------------------
-// CONNECTION
-
-// connection is a single connection from the output of one pin
-// to the input of another. It is used to describe both input and output
-// connections from each node, but src and dst reverses on input. That
-// is, as an output connection, the srcPin is the pin sending data.
-// As an input connection, the srcPin is the pin receiving data.
-type connection struct {
-	srcPin  string
-	dstNode *container
-	dstPin  string
-}
-
-// --------------------------------
-// PIPELINE-PIN-DESCR
-
-type pipelinePinDescr struct {
-	PinDescr
-	connections []connectionDescr
-}
-
-type connectionDescr struct {
-	DstNode string
-	DstPin  string
-}
-
-func newConnectionDescr(comp string) connectionDescr {
-	v := strings.Split(comp, ":")
-	if len(v) != 2 {
-		return connectionDescr{}
-	}
-	return connectionDescr{v[0], v[1]}
-}
-
-func pipelineFakeFmt() {
-	fmt.Println()
-}
-
-// --------------------------------
-// STOPPED
-
-const (
-	emptyStopped       = iota // The pipeline has not been started
-	running                   // The pipeline is running
-	requestedStopped          // A client has requested the pipeline to stop
-	runFinishedStopped        // The pipeline processing finished
-)
+package phly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/micro-go/lock"
+	"github.com/micro-go/parse"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------------
+// PIPELINE interface
+
+type Pipeline interface {
+	// Run() starts the pipeline and waits for it to finish, answering
+	// everything the pipeline sent to its declared outs.
+	// The context is handed to every node, and cancelling it stops the pipeline.
+	Run(ctx context.Context, args StartArgs, input Pins) (Pins, error)
+	Start(ctx context.Context, args StartArgs, input Pins) error
+	Stop() error
+	Wait() error
+	// Pause() stops handing input to nodes until Resume(). Output sent by
+	// running nodes still arrives in their destination queues. Nodes that
+	// set NodeDescr.Pausable receive the NodePausing and NodeResuming stages.
+	Pause() error
+	Resume() error
+	// Checkpoint() answers the current state of the run, which can be
+	// resumed later. Nodes are briefly held while it's taken.
+	Checkpoint() (*Checkpoint, error)
+	// Stats() answers the stats for the current run, or the last one if it
+	// has finished. The stats are empty if the pipeline hasn't started.
+	Stats() PipelineStats
+	// Plan() answers the plan for the current or last run. Node
+	// actions are only recorded in a dry run.
+	Plan() PipelinePlan
+}
+
+// --------------------------------
+// PIPELINE start
+
+// StartArgs provides arguments when starting the pipeline.
+type StartArgs struct {
+	Cla      map[string]string // Command line arguments
+	Tracer   Tracer            // Optional receiver for events as the pipeline runs
+	Observer Observer          // Optional receiver for events, delivered without blocking the runner
+	DryRun   bool              // Nodes report what they would do instead of doing it. See Plan().
+	Resume   *Checkpoint       // Optional checkpoint to continue from
+	output   NodeOutput        // The receiver for any output from this pipeline
+	observer *observer_queue   // The queue of the pipeline running me, which I share
+	args     map[string]string // Values for my args, set by the pipeline running me
+}
+
+// --------------------------------
+// PIPELINE struct
+
+type pipeline struct {
+	engine      *Engine                `json:"-"` // Provides the nodes and environment
+	workingdir  string                 `json:"-"`
+	args        pipeline_args          `json:"-"`
+	file        string                 `json:"-"`
+	ins         []connection           `json:"-"`
+	nodes       map[string]*container  `json:"-"`
+	inputDescr  []pipelinePinDescr     `json:"-"`
+	outputDescr []pipelinePinDescr     `json:"-"`
+	timeout     time.Duration          `json:"-"` // Optional limit on how long the pipeline can run
+	workers     string                 `json:"-"` // The number of nodes that can process at once. Supports vars.
+	queue       queuecfg               `json:"-"` // The default for the edges into every node
+	loops       map[connection_key]int `json:"-"` // The limit on each edge that closes a cycle
+	// running
+	mutex  sync.Mutex       `json:"-"`
+	runner *pipeline_runner `json:"-"`
+}
+
+func (p *pipeline) Describe() NodeDescr {
+	descr := NodeDescr{Id: "phly/pipeline", Name: "Pipeline", Purpose: "Run an internal pipeline. Its ins and outs are the node's pins, and its errors are handled by the node's onError.", Pausable: true}
+	descr.Cfgs = append(descr.Cfgs, CfgDescr{Name: "file", Purpose: "The pipeline file to run."})
+	descr.Cfgs = append(descr.Cfgs, CfgDescr{Name: "args", Purpose: "Values for the args declared by the file, replacing their defaults."})
+	for _, pin := range p.inputDescr {
+		descr.InputPins = append(descr.InputPins, PinDescr{Name: pin.Name, Purpose: pin.Purpose})
+	}
+	for _, pin := range p.outputDescr {
+		descr.OutputPins = append(descr.OutputPins, PinDescr{Name: pin.Name, Purpose: pin.Purpose})
+	}
+	return descr
+}
+
+func (p *pipeline) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	ans := &pipeline{engine: args.engine}
+	file, _ := parse.FindTreeString("file", cfg)
+	if file != "" {
+		ans.file = file
+		r := args.Env.FindReader(file)
+		if r == nil {
+			return nil, errors.New("Pipeline can't find " + file)
+		}
+		err := readPipeline(r, ans)
+		if err != nil {
+			return nil, err
+		}
+		// The cfg can set my args, like calling a function with parameters.
+		if values, ok := parse.FindTreeValue("args", cfg); ok {
+			err = ans.args.setValues(args.Env, file, values)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ans, nil
+}
+
+// Process() runs me as a node in another pipeline. Input on my ins is
+// routed to my nodes, anything sent to my outs is sent on from the node,
+// and I stop, with any error, when my run finishes. Input that arrives
+// after the run finished starts a new one, even if the run failed, since
+// the error policy of the node running me might continue past it.
+func (p *pipeline) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	sargs := StartArgs{Cla: args.cla, Tracer: args.tracer, DryRun: args.dryRun, output: output, observer: args.observer, args: p.args.resolveSet(args)}
+	if stage == NodeStarting {
+		p.Stop()
+		return p.Start(args.Context(), sargs, input)
+	} else if stage == NodeRunning {
+		r := p.getRunner()
+		if r != nil && r.input(input) {
+			return nil
+		}
+		if r != nil {
+			// Wait for the finished run to stop the node. A failed run is
+			// handled by the error policy of the node running me.
+			<-r.parentDone
+		}
+		// The finished run stopped the node, but I'm running again.
+		if o, ok := output.(*pipelineNodeOutput); ok {
+			o.stopped.SetTo(false)
+		}
+		return p.Start(args.Context(), sargs, input)
+	} else if stage == NodePausing {
+		return p.Pause()
+	} else if stage == NodeResuming {
+		return p.Resume()
+	}
+	return nil
+}
+
+func (p *pipeline) StopNode(args StoppedArgs) error {
+	return p.Stop()
+}
+
+func (p *pipeline) Run(ctx context.Context, args StartArgs, input Pins) (Pins, error) {
+	err := p.Start(ctx, args, input)
+	if err != nil {
+		return nil, err
+	}
+	r := p.getRunner()
+	err = p.Wait()
+	return r.getOutput(), err
+}
+
+func (p *pipeline) Start(ctx context.Context, args StartArgs, input Pins) error {
+	p.Stop()
+	pargs := ProcessArgs{env: p.getEngine().env, dryRun: args.DryRun, workingdir: p.workingdir, cla: args.Cla, tracer: args.Tracer, argValues: args.args}
+
+	defer lock.Locker(&p.mutex).Unlock()
+	runner, err := startPipelineRunner(ctx, p, args, pargs, input)
+	if err != nil {
+		return err
+	}
+	p.runner = runner
+	return nil
+}
+
+func (p *pipeline) Stop() error {
+	defer lock.Locker(&p.mutex).Unlock()
+
+	var err error
+	if p.runner != nil {
+		err = p.runner.close()
+		p.runner = nil
+	}
+	return err
+}
+
+func (p *pipeline) Wait() error {
+	r := p.getRunner()
+	if r == nil {
+		return NewIllegalError("Waiting but nothing started")
+	}
+	r.wait.Wait()
+	return r.err.Get()
+}
+
+func (p *pipeline) Pause() error {
+	return p.sendControl(whatPause)
+}
+
+func (p *pipeline) Resume() error {
+	return p.sendControl(whatResume)
+}
+
+// sendControl() sends a message that controls the running pipeline.
+func (p *pipeline) sendControl(what string) error {
+	r := p.getRunner()
+	if r == nil {
+		return NewIllegalError("No running pipeline to " + what)
+	}
+	r.router.send(newPipelineMsg(Msg{What: what}, ""))
+	return nil
+}
+
+func (p *pipeline) Checkpoint() (*Checkpoint, error) {
+	r := p.getRunner()
+	if r == nil {
+		return nil, NewIllegalError("No running pipeline to checkpoint")
+	}
+	reply := make(chan *Checkpoint, 1)
+	r.router.send(newPipelineMsg(Msg{What: whatCheckpoint, Payload: reply}, ""))
+	select {
+	case c := <-reply:
+		return c, nil
+	case <-r.finished:
+		select {
+		case c := <-reply:
+			return c, nil
+		default:
+			return nil, NewIllegalError("Pipeline finished before the checkpoint")
+		}
+	}
+}
+
+func (p *pipeline) Stats() PipelineStats {
+	r := p.getRunner()
+	if r == nil {
+		return PipelineStats{Nodes: make(map[string]NodeStats)}
+	}
+	ans := r.stats.get()
+	for i, e := range ans.Edges {
+		ans.Edges[i].Depth = r.router.depth(e)
+	}
+	return ans
+}
+
+func (p *pipeline) Plan() PipelinePlan {
+	r := p.getRunner()
+	if r == nil {
+		return newRunPlan().get(p, ProcessArgs{env: p.getEngine().env})
+	}
+	return r.pargs.plan.get(p, r.pargs)
+}
+
+// workerCount() answers the number of nodes that can process at once.
+func (p *pipeline) workerCount() int {
+	workers := p.workers
+	if workers == "" {
+		workers = default_workers
+	}
+	n, err := parse.SolveInt(p.getEngine().env.ReplaceVars(workers))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// queueCfg() answers the queue settings for the edges into the node.
+func (p *pipeline) queueCfg(c *container) queuecfg {
+	q := queuecfg{Capacity: default_queue_capacity, Overflow: default_queue_overflow}
+	return q.merge(p.queue).merge(c.queue)
+}
+
+// routeInput() hands the input on each of my ins to fn,
+// once for every node and pin the in connects to.
+func (p *pipeline) routeInput(input Pins, fn func(name string, dst connectionDescr, docs *Docs)) {
+	if input == nil {
+		return
+	}
+	for _, descr := range p.inputDescr {
+		docs := input.GetPin(descr.Name)
+		if len(docs.Docs) < 1 {
+			continue
+		}
+		for i, conn := range descr.connections {
+			// All but the last destination receive a copy.
+			send := &docs
+			if i < len(descr.connections)-1 {
+				send = docs.Copy()
+			}
+			fn(descr.Name, conn, send)
+		}
+	}
+}
+
+// getEngine() answers the engine that loaded me, or the default engine.
+func (p *pipeline) getEngine() *Engine {
+	if p.engine == nil {
+		return defaultEngine
+	}
+	return p.engine
+}
+
+// getRunner() answers the current runner, so we don't have
+// to keep a lock during the wait.
+func (p *pipeline) getRunner() *pipeline_runner {
+	defer lock.Locker(&p.mutex).Unlock()
+	return p.runner
+}
+
+// ResolveOutput() takes a source node name and pin and converts it into
+// every destination node name and pin connected to it.
+func (p *pipeline) ResolveOutput(srcnode, srcpin string) ([]connectionDescr, error) {
+	c, ok := p.nodes[srcnode]
+	if c == nil || !ok {
+		return nil, NewBadRequestError("Node " + srcnode + " does not exist")
+	}
+	var dsts []connectionDescr
+	for _, conn := range c.outputs {
+		if conn.srcPin == srcpin {
+			dsts = append(dsts, connectionDescr{conn.dstNode.name, conn.dstPin})
+		}
+	}
+	if len(dsts) < 1 {
+		return nil, NewBadRequestError("Node " + srcnode + " does not have pin " + srcpin)
+	}
+	return dsts, nil
+}
+
+func (p *pipeline) add(name string, n Node) error {
+	if p.nodes == nil {
+		p.nodes = make(map[string]*container)
+	}
+	_, ok := p.nodes[name]
+	if ok {
+		return NewIllegalError("Duplicate nodes named " + name)
+	}
+	p.nodes[name] = &container{name: name, node: n}
+	return nil
+}
+
+func (p *pipeline) addInput(srcpin string, dstnode *container, dstpin string) error {
+	if !(dstnode.name == args_container.name || dstnode.name == pipeline_container.name) {
+		return NewIllegalError("Invalid pin " + srcpin + " to " + dstnode.name + "->" + dstpin)
+	}
+	p.ins = append(p.ins, connection{srcpin, dstnode, dstpin})
+	return nil
+}
+
+// --------------------------------
+// CONTAINER
+
+// container decorates a node with the input and output connections.
+type container struct {
+	name    string
+	node    Node
+	cfg     interface{} // The cfg the node was created with
+	queue   queuecfg    // Optional settings for the edges into this node
+	onError errorcfg    // What happens when Process answers an error
+	// The number of times output can be sent back around a cycle
+	maxIterations int
+	inputs        []connection
+	outputs       []connection
+}
+
+var (
+	args_container     = &container{name: "args"}
+	pipeline_container = &container{name: ".pipeline"}
+)
+
+func (c *container) connect(srcpin string, dstnode *container, dstpin string) error {
+	if dstnode == nil || dstnode.node == nil {
+		return BadRequestErr
+	}
+	c.outputs = append(c.outputs, connection{srcpin, dstnode, dstpin})
+	dstnode.inputs = append(dstnode.inputs, connection{dstpin, c, srcpin})
+	return nil
+}
+
+// connectInput creates a one-way connection, for when we don't have the other node.
+func (c *container) connectInput(srcpin string, dstnode *container, dstpin string) error {
+	if dstnode == nil || dstnode.name == "" {
+		return BadRequestErr
+	}
+	c.inputs = append(c.inputs, connection{srcpin, dstnode, dstpin})
+	return nil
+}
+
+// connectOutput creates a one-way connection, for when we don't have the other node.
+func (c *container) connectOutput(srcpin string, dstnode *container, dstpin string) error {
+	if dstnode == nil || dstnode.name == "" {
+		return BadRequestErr
+	}
+	c.outputs = append(c.outputs, connection{srcpin, dstnode, dstpin})
+	return nil
+}
+
+// close() closes the node, if possible.
+func (c *container) close() error {
+	if closer, ok := c.node.(io.Closer); ok && closer != nil {
+		return closer.Close()
+	}
+	return nil
+}
+
+// --------------------------------
+// CONNECTION
+
+// connection is a single connection from the output of one pin
+// to the input of another. It is used to describe both input and output
+// connections from each node, but src and dst reverses on input. That
+// is, as an output connection, the srcPin is the pin sending data.
+// As an input connection, the srcPin is the pin receiving data.
+type connection struct {
+	srcPin  string
+	dstNode *container
+	dstPin  string
+}
+
+// --------------------------------
+// PIPELINE-PIN-DESCR
+
+type pipelinePinDescr struct {
+	PinDescr
+	connections []connectionDescr
+}
+
+type connectionDescr struct {
+	DstNode string
+	DstPin  string
+}
+
+func newConnectionDescr(comp string) connectionDescr {
+	v := strings.Split(comp, ":")
+	if len(v) != 2 {
+		return connectionDescr{}
+	}
+	return connectionDescr{v[0], v[1]}
+}
+
+func pipelineFakeFmt() {
+	fmt.Println()
+}
+
+// --------------------------------
+// CONST and VAR
+
+const (
+	default_workers = "${cpus}"
+)
+
+// --------------------------------
+// STOPPED
+
+const (
+	emptyStopped       = iota // The pipeline has not been started
+	running                   // The pipeline is running
+	requestedStopped          // A client has requested the pipeline to stop
+	runFinishedStopped        // The pipeline processing finished
+)
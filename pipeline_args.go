@@ -0,0 +1,386 @@
+package phly
+
+import (
+	"errors"
+	"github.com/micro-go/parse"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// --------------------------------
+// PIPELINE-ARGS
+
+type arg_format string
+
+const (
+	empty_format  arg_format = ""
+	string_format arg_format = "string"
+	int_format    arg_format = "int"
+	float_format  arg_format = "float"
+	bool_format   arg_format = "bool"
+	path_format   arg_format = "path" // A string, made relative to the pipeline file
+	list_format   arg_format = "list" // Comma-separated strings
+	enum_format   arg_format = "enum" // A string from the allowed values
+)
+
+// pipeline_args provides a list of all pipeline args.
+type pipeline_args struct {
+	env  string
+	args map[string]pipeline_arg
+	set  map[string]string // Values from the cfg of the pipeline running me, which can use its args as vars
+}
+
+// make() adds the args in all. Numbers, bools and lists are
+// converted to the string an env var or command line would provide.
+func (p *pipeline_args) make(frmt arg_format, all map[string]interface{}) error {
+	if all == nil {
+		return nil
+	}
+	for k, _v := range all {
+		_, exists := p.arg(k)
+		if exists {
+			return errors.New("Duplicate arg: " + k)
+		}
+		v, ok := argString(_v)
+		if !ok {
+			return NewBadRequestError("Arg " + k + " must be a string, number, bool or list")
+		}
+		p.setArg(k, frmt, v)
+	}
+	return nil
+}
+
+// makeTyped() adds the args declared with a type, validating
+// each declaration and its default.
+func (p *pipeline_args) makeTyped(all map[string]argcfg) error {
+	for k, cfg := range all {
+		_, exists := p.arg(k)
+		if exists {
+			return errors.New("Duplicate arg: " + k)
+		}
+		a, err := cfg.asArg(k)
+		if err != nil {
+			return err
+		}
+		if p.args == nil {
+			p.args = make(map[string]pipeline_arg)
+		}
+		p.args[k] = a
+	}
+	return nil
+}
+
+// valueDoc() answers a new doc on the given arg, resolving input sources.
+// The doc is nil if the arg has no value, and the error is for values
+// that don't match the arg's type, or a required arg without a value.
+func (p *pipeline_args) valueDoc(args ProcessArgs, name string) (*Doc, error) {
+	a, ok := p.arg(name)
+	if !ok {
+		return nil, nil
+	}
+	return a.valueDoc(args, name, p.value(args, a, name))
+}
+
+// value() answers the unconverted value of the arg. A value set by the
+// pipeline running me takes precedence over every other source.
+func (p *pipeline_args) value(args ProcessArgs, a pipeline_arg, name string) string {
+	if v, ok := args.argValues[name]; ok {
+		return v
+	}
+	// Make env name
+	env_name := ""
+	if p.env != "" {
+		env_name = p.env + strings.ToUpper(name)
+	}
+	cla_name := name
+	return a.resolve(args, env_name, cla_name)
+}
+
+// vars() answers my values as "${name}", value pairs, so the cfg of a
+// nested pipeline can pass them on. Paths are answered in full, since
+// the nested pipeline's file can be somewhere else.
+func (p *pipeline_args) vars(args ProcessArgs) []interface{} {
+	var ans []interface{}
+	for name, a := range p.args {
+		value := p.value(args, a, name)
+		if a.format == path_format && value != "" {
+			value = args.Filename(value)
+		}
+		ans = append(ans, "${"+name+"}", value)
+	}
+	return ans
+}
+
+func (p *pipeline_args) arg(name string) (pipeline_arg, bool) {
+	if p.args == nil {
+		return pipeline_arg{}, false
+	}
+	ans, ok := p.args[name]
+	return ans, ok
+}
+
+// setValues() sets the values of the args from the "args" in the cfg of
+// a nested pipeline. They take precedence over environment variables and
+// command line arguments, and can use the args of the pipeline running me
+// as vars, so they're resolved when each run starts. Every arg must be declared.
+func (p *pipeline_args) setValues(env Environment, file string, _values interface{}) error {
+	values, ok := _values.(map[string]interface{})
+	if !ok {
+		return NewBadRequestError("Args for " + file + " must be an object")
+	}
+	for k, v := range values {
+		a, ok := p.arg(k)
+		if !ok {
+			return NewBadRequestError("Pipeline " + file + " has no arg " + k)
+		}
+		value, ok := argString(v)
+		if !ok {
+			return NewBadRequestError("Arg " + k + " for " + file + " must be a string, number, bool or list")
+		}
+		// Values with vars are checked once they're resolved.
+		if !strings.Contains(value, "${") {
+			if _, err := a.convert(env.ReplaceVars(value)); err != nil {
+				return NewBadRequestError("Arg " + k + " for " + file + ": " + err.Error())
+			}
+		}
+		if p.set == nil {
+			p.set = make(map[string]string)
+		}
+		p.set[k] = value
+	}
+	return nil
+}
+
+// resolveSet() answers the values set by setValues(), with the vars
+// replaced by the args of the pipeline running me, then the environment.
+func (p *pipeline_args) resolveSet(args ProcessArgs) map[string]string {
+	if len(p.set) < 1 {
+		return nil
+	}
+	ans := make(map[string]string)
+	for k, v := range p.set {
+		ans[k] = args.env.ReplaceVars(parse.ReplacePairs(v, args.argVars...))
+	}
+	return ans
+}
+
+func (p *pipeline_args) setArg(name string, format arg_format, value string) {
+	if p.args == nil {
+		p.args = make(map[string]pipeline_arg)
+	}
+	p.args[name] = pipeline_arg{format: format, value: value}
+}
+
+// --------------------------------
+// PIPELINE-ARG
+
+// pipeline_arg is a single argument into the pipeline.
+type pipeline_arg struct {
+	format   arg_format
+	value    string // The default, or empty for none
+	descr    string
+	required bool     // The pipeline can't start without a value
+	allowed  []string // The values the arg can have, or empty for any
+}
+
+// resolve() answers my value from the input sources.
+func (p pipeline_arg) resolve(args ProcessArgs, env_name, cla_name string) string {
+	// Order of precedence: default value, environment variable, command line arg.
+	value := p.value
+	if env_name != "" {
+		if v, ok := os.LookupEnv(env_name); ok {
+			value = v
+		}
+	}
+	cla := args.ClaValue(cla_name)
+	if cla != "" {
+		value = cla
+	}
+	return value
+}
+
+// valueDoc() answers a new doc on the value, converted to my type.
+func (p pipeline_arg) valueDoc(args ProcessArgs, name, value string) (*Doc, error) {
+	// Strings have always answered a doc, even when empty.
+	if value == "" && (p.format != string_format || p.required) {
+		if p.required {
+			return nil, NewMissingError("Required arg " + name + p.descrString())
+		}
+		return nil, nil
+	}
+	item, err := p.convert(value)
+	if err != nil {
+		return nil, NewBadRequestError("Arg " + name + ": " + err.Error())
+	}
+	doc := &Doc{}
+	switch p.format {
+	case string_format, enum_format:
+		doc.MimeType = texttype
+	case path_format:
+		doc.MimeType = texttype
+		item = args.Filename(value)
+	}
+	doc.AppendItem(item)
+	return doc, nil
+}
+
+// convert() answers the value as my type, or an error if it
+// isn't one, or isn't one of my allowed values.
+func (p pipeline_arg) convert(value string) (interface{}, error) {
+	var ans interface{}
+	var err error
+	check := []string{value}
+	switch p.format {
+	case int_format:
+		ans, err = strconv.Atoi(strings.TrimSpace(value))
+	case float_format:
+		ans, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case bool_format:
+		ans, err = strconv.ParseBool(strings.TrimSpace(value))
+	case list_format:
+		list := []string{}
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		ans, check = list, list
+	default:
+		ans = value
+	}
+	if err != nil {
+		return nil, errors.New("\"" + value + "\" isn't a " + string(p.format))
+	}
+	for _, v := range check {
+		if !p.allows(v) {
+			return nil, errors.New("\"" + v + "\" isn't one of " + strings.Join(p.allowed, ", "))
+		}
+	}
+	return ans, nil
+}
+
+// allows() answers true if the value is one of my allowed values.
+// Numbers are compared by value, so "1.0" matches an allowed "1".
+func (p pipeline_arg) allows(value string) bool {
+	if len(p.allowed) < 1 {
+		return true
+	}
+	for _, a := range p.allowed {
+		if a == value {
+			return true
+		}
+		if p.format == int_format || p.format == float_format {
+			af, aerr := strconv.ParseFloat(a, 64)
+			vf, verr := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if aerr == nil && verr == nil && af == vf {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p pipeline_arg) descrString() string {
+	if p.descr == "" {
+		return ""
+	}
+	return " (" + p.descr + ")"
+}
+
+// typed() answers true if I need an argcfg to be written, instead
+// of a simple string.
+func (p pipeline_arg) typed() bool {
+	return p.format != string_format || p.descr != "" || p.required || len(p.allowed) > 0
+}
+
+// asCfg() answers the cfg that reads back into me.
+func (p pipeline_arg) asCfg() argcfg {
+	cfg := argcfg{Type: p.format, Description: p.descr, Required: p.required}
+	if p.value != "" {
+		cfg.Default = p.value
+		if v, err := p.convert(p.value); err == nil {
+			cfg.Default = v
+		}
+	}
+	for _, a := range p.allowed {
+		cfg.Values = append(cfg.Values, a)
+	}
+	return cfg
+}
+
+// --------------------------------
+// ARG-CFG
+
+// argcfg declares a typed arg in the "typed" section of the pipeline args:
+// { "type": "int", "default": 100, "description": "Width in pixels" }
+// { "type": "enum", "values": [ "fit", "fill" ], "required": true }
+type argcfg struct {
+	Type        arg_format    `json:"type,omitempty"` // Defaults to string
+	Default     interface{}   `json:"default,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Values      []interface{} `json:"values,omitempty"` // The allowed values
+}
+
+// asArg() answers the arg, or an error if the declaration or default are invalid.
+func (c argcfg) asArg(name string) (pipeline_arg, error) {
+	a := pipeline_arg{format: c.Type, descr: c.Description, required: c.Required}
+	switch a.format {
+	case empty_format:
+		a.format = string_format
+	case string_format, int_format, float_format, bool_format, path_format, list_format, enum_format:
+	default:
+		return a, NewBadRequestError("Arg " + name + " has unknown type " + string(c.Type))
+	}
+	for _, v := range c.Values {
+		s, ok := argString(v)
+		if !ok {
+			return a, NewBadRequestError("Arg " + name + " has an invalid value")
+		}
+		a.allowed = append(a.allowed, s)
+	}
+	if a.format == enum_format && len(a.allowed) < 1 {
+		return a, NewBadRequestError("Enum arg " + name + " needs values")
+	}
+	value, ok := argString(c.Default)
+	if !ok {
+		return a, NewBadRequestError("Arg " + name + " has an invalid default")
+	}
+	a.value = value
+	if a.value != "" {
+		if _, err := a.convert(a.value); err != nil {
+			return a, NewBadRequestError("Arg " + name + " default: " + err.Error())
+		}
+	}
+	return a, nil
+}
+
+// --------------------------------
+// MISC
+
+// argString() answers the cfg value as the string an env var
+// or command line would provide.
+func argString(_v interface{}) (string, bool) {
+	switch v := _v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case []interface{}:
+		var all []string
+		for _, vv := range v {
+			s, ok := argString(vv)
+			if !ok {
+				return "", false
+			}
+			all = append(all, s)
+		}
+		return strings.Join(all, ","), true
+	}
+	return "", false
+}
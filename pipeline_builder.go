@@ -0,0 +1,309 @@
+package phly
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ----------------------------------------
+// PIPELINE-BUILDER
+
+// PipelineBuilder creates a pipeline from Go code instead of a file.
+// It builds the same cfg a pipeline file would, so the built pipeline
+// is read and validated exactly like a loaded one. Problems are collected
+// as the builder is used and answered by Build().
+// Example:
+//
+//	b := phly.NewPipelineBuilder()
+//	b.Node("files", "phly/files", cfg)
+//	b.Node("batch", "phly/batch", nil)
+//	b.Connect("files:out", "batch:in")
+//	b.Settings("batch", phly.NodeSettings{OnError: phly.ErrorContinue})
+//	p, err := b.Build()
+type PipelineBuilder struct {
+	engine *Engine
+	cfg    pipelinecfg
+	args   pipeline_args_io
+	nodes  map[string]builderNode
+	conns  []builderConnection
+	err    error
+}
+
+// NewPipelineBuilder() answers a builder for pipelines that use the default engine.
+func NewPipelineBuilder() *PipelineBuilder {
+	return defaultEngine.NewPipelineBuilder()
+}
+
+// NewPipelineBuilder() answers a builder for pipelines that use my nodes and vars.
+func (e *Engine) NewPipelineBuilder() *PipelineBuilder {
+	return &PipelineBuilder{engine: e, nodes: make(map[string]builderNode)}
+}
+
+// Node() adds a node named name, created from the registered id. The cfg
+// is anything that marshals to the node's json cfg, or nil.
+func (b *PipelineBuilder) Node(name, id string, cfg interface{}) *PipelineBuilder {
+	if _, ok := b.nodes[name]; ok {
+		b.err = MergeErrors(b.err, NewBadRequestError("Duplicate node "+name))
+		return b
+	}
+	b.nodes[name] = builderNode{id: id, cfg: cfg}
+	return b
+}
+
+// Settings() replaces the optional settings of the named node, which
+// must already be added.
+func (b *PipelineBuilder) Settings(name string, settings NodeSettings) *PipelineBuilder {
+	n, ok := b.nodes[name]
+	if !ok {
+		b.err = MergeErrors(b.err, NewMissingError("Node "+name))
+		return b
+	}
+	n.settings = settings
+	b.nodes[name] = n
+	return b
+}
+
+// Connect() connects the src "node:pin" to the dst "node:pin". The src
+// can also be "args:name" to send an arg to the dst.
+func (b *PipelineBuilder) Connect(src, dst string) *PipelineBuilder {
+	srcparts, dstparts := strings.Split(src, ":"), strings.Split(dst, ":")
+	if len(srcparts) != 2 || len(dstparts) != 2 {
+		b.err = MergeErrors(b.err, wrongFormatPinsErr)
+		return b
+	}
+	b.conns = append(b.conns, builderConnection{srcparts[0], srcparts[1], dstparts[0], dstparts[1]})
+	return b
+}
+
+// Arg() declares an arg with its default value. See the "args" in the pipeline file.
+func (b *PipelineBuilder) Arg(name, value string) *PipelineBuilder {
+	if b.args.Strings == nil {
+		b.args.Strings = make(map[string]interface{})
+	}
+	b.args.Strings[name] = value
+	return b
+}
+
+// TypedArg() declares an arg with a type. See the "args.typed" in the pipeline file.
+func (b *PipelineBuilder) TypedArg(name string, arg ArgSettings) *PipelineBuilder {
+	if b.args.Typed == nil {
+		b.args.Typed = make(map[string]argcfg)
+	}
+	b.args.Typed[name] = argcfg{arg_format(arg.Type), arg.Default, arg.Description, arg.Required, arg.Values}
+	return b
+}
+
+// ArgsEnv() sets the prefix for environment variables that supply arg values.
+func (b *PipelineBuilder) ArgsEnv(prefix string) *PipelineBuilder {
+	b.args.Env = prefix
+	return b
+}
+
+// Timeout() sets how long the pipeline can run. 0 is no limit.
+func (b *PipelineBuilder) Timeout(d time.Duration) *PipelineBuilder {
+	b.cfg.Timeout = ""
+	if d > 0 {
+		b.cfg.Timeout = d.String()
+	}
+	return b
+}
+
+// Workers() sets the number of nodes that can process at once.
+func (b *PipelineBuilder) Workers(n int) *PipelineBuilder {
+	b.cfg.Workers = strconv.Itoa(n)
+	return b
+}
+
+// Queue() sets the capacity and overflow policy of the edges into every
+// node. A node's own settings replace them. 0 and "" keep the defaults.
+func (b *PipelineBuilder) Queue(capacity int, overflow OverflowPolicy) *PipelineBuilder {
+	b.cfg.Queue = &queuecfg{capacity, overflow}
+	return b
+}
+
+// In() adds a pipeline input that sends to each dst "node:pin".
+func (b *PipelineBuilder) In(name string, dst ...string) *PipelineBuilder {
+	if b.cfg.Ins == nil {
+		b.cfg.Ins = make(map[string][]string)
+	}
+	b.cfg.Ins[name] = append(b.cfg.Ins[name], dst...)
+	return b
+}
+
+// Out() adds a pipeline output that collects from each src "node:pin".
+func (b *PipelineBuilder) Out(name string, src ...string) *PipelineBuilder {
+	if b.cfg.Outs == nil {
+		b.cfg.Outs = make(map[string][]string)
+	}
+	b.cfg.Outs[name] = append(b.cfg.Outs[name], src...)
+	return b
+}
+
+// Build() answers a new pipeline from everything added to me. It answers
+// a ValidateError for the same problems that LoadPipeline() would find.
+func (b *PipelineBuilder) Build() (Pipeline, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	cfg, problems := b.makeCfg()
+	p := &pipeline{engine: b.engine}
+	err := readPipelineCfg(cfg, p, problems...)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// makeCfg() answers a new cfg, so I can keep building after Build(),
+// along with any connections from nodes that don't exist.
+func (b *PipelineBuilder) makeCfg() (*pipelinecfg, []ValidateProblem) {
+	cfg := b.cfg
+	cfg.Args = &pipeline_args_io{Env: b.args.Env, Strings: copyStringMap(b.args.Strings), Typed: copyArgMap(b.args.Typed)}
+	cfg.Ins = copyPinMap(b.cfg.Ins)
+	cfg.Outs = copyPinMap(b.cfg.Outs)
+	cfg.Nodes = make(map[string]interface{})
+	trees := make(map[string]map[string]interface{})
+	for k, v := range b.nodes {
+		tree := map[string]interface{}{"node": v.id}
+		if v.cfg != nil {
+			tree["cfg"] = v.cfg
+		}
+		v.settings.addTo(tree)
+		trees[k] = tree
+		cfg.Nodes[k] = tree
+	}
+
+	var problems []ValidateProblem
+	for _, c := range b.conns {
+		if c.srcNode == args_container.name {
+			tree, ok := trees[c.dstNode]
+			if !ok {
+				problems = append(problems, ValidateProblem{Node: c.dstNode, Pin: c.dstPin, Msg: "Input to missing node " + c.dstNode})
+				continue
+			}
+			builderPins(tree, "ins")[c.dstPin] = c.srcNode + ":" + c.srcPin
+			continue
+		}
+		tree, ok := trees[c.srcNode]
+		if !ok {
+			problems = append(problems, ValidateProblem{Node: c.srcNode, Pin: c.srcPin, Msg: "Output from missing node " + c.srcNode})
+			continue
+		}
+		pins := builderPins(tree, "outs")
+		dsts, _ := pins[c.srcPin].([]interface{})
+		pins[c.srcPin] = append(dsts, c.dstNode+":"+c.dstPin)
+	}
+	return &cfg, problems
+}
+
+// ----------------------------------------
+// BUILDER-NODE
+
+type builderNode struct {
+	id       string
+	cfg      interface{}
+	settings NodeSettings
+}
+
+// ----------------------------------------
+// NODE-SETTINGS
+
+// NodeSettings are the optional settings for a node added to a
+// PipelineBuilder, the same as those beside its cfg in a pipeline file.
+// Zero values keep the defaults.
+type NodeSettings struct {
+	Capacity      int            // The capacity of each edge into the node
+	Overflow      OverflowPolicy // What happens when input arrives on a full edge
+	OnError       ErrorPolicy    // What happens when Process answers an error
+	RetryCount    int            // The number of retries, for ErrorRetry
+	RetryBackoff  time.Duration  // The wait before the first retry, for ErrorRetry
+	ErrorPin      string         // The output pin for routed errors, for ErrorRoute
+	MaxIterations int            // The number of times output can be sent back around a cycle from the node
+}
+
+// addTo() adds my settings to the node tree, the way a pipeline file would.
+func (s NodeSettings) addTo(tree map[string]interface{}) {
+	if s.Capacity != 0 || s.Overflow != "" {
+		tree["queue"] = map[string]interface{}{"capacity": s.Capacity, "overflow": string(s.Overflow)}
+	}
+	if s.OnError != "" {
+		onError := map[string]interface{}{"policy": string(s.OnError), "count": s.RetryCount, "pin": s.ErrorPin}
+		if s.RetryBackoff != 0 {
+			onError["backoff"] = s.RetryBackoff.String()
+		}
+		tree["onError"] = onError
+	}
+	if s.MaxIterations != 0 {
+		tree["maxIterations"] = float64(s.MaxIterations)
+	}
+}
+
+// ----------------------------------------
+// ARG-SETTINGS
+
+// ArgSettings declares an arg with a type, the same as an entry in
+// "args.typed" in a pipeline file.
+type ArgSettings struct {
+	Type        string        // string, int, float, bool, path, list or enum. Defaults to string
+	Default     interface{}   // Used when no other source has a value
+	Description string        // Shown to users
+	Required    bool          // The run fails without a value
+	Values      []interface{} // The allowed values, for enum
+}
+
+// ----------------------------------------
+// BUILDER-CONNECTION
+
+type builderConnection struct {
+	srcNode string
+	srcPin  string
+	dstNode string
+	dstPin  string
+}
+
+// ----------------------------------------
+// MISC
+
+// builderPins() answers the pins map at key in the node tree, creating it if needed.
+func builderPins(tree map[string]interface{}, key string) map[string]interface{} {
+	if pins, ok := tree[key].(map[string]interface{}); ok {
+		return pins
+	}
+	pins := make(map[string]interface{})
+	tree[key] = pins
+	return pins
+}
+
+func copyStringMap(src map[string]interface{}) map[string]interface{} {
+	if src == nil {
+		return nil
+	}
+	dst := make(map[string]interface{})
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func copyArgMap(src map[string]argcfg) map[string]argcfg {
+	if src == nil {
+		return nil
+	}
+	dst := make(map[string]argcfg)
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func copyPinMap(src map[string][]string) map[string][]string {
+	if src == nil {
+		return nil
+	}
+	dst := make(map[string][]string)
+	for k, v := range src {
+		dst[k] = append([]string{}, v...)
+	}
+	return dst
+}
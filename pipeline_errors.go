@@ -0,0 +1,136 @@
+package phly
+
+import (
+	"encoding/json"
+	"github.com/micro-go/parse"
+	"time"
+)
+
+// ----------------------------------------
+// ERROR-POLICY
+
+// ErrorPolicy determines what happens when a node's Process answers an error.
+type ErrorPolicy string
+
+const (
+	ErrorFail     ErrorPolicy = "fail"     // The pipeline stops with the error
+	ErrorContinue ErrorPolicy = "continue" // The error is traced, and a new node takes the next input, with the startup input of the failed one
+	ErrorRetry    ErrorPolicy = "retry"    // Process is called again with the same input, then the pipeline fails
+	ErrorRoute    ErrorPolicy = "route"    // The error is sent as a doc on an error pin
+)
+
+// ----------------------------------------
+// ERROR-CFG
+
+// errorcfg describes a node's "onError" setting. It can be a policy
+// name, or an object with the policy and its settings:
+// { "policy": "retry", "count": 3, "backoff": "100ms" }
+// { "policy": "route", "pin": "error" }
+type errorcfg struct {
+	Policy  ErrorPolicy `json:"policy,omitempty"`
+	Count   int         `json:"count,omitempty"`   // The number of retries
+	Backoff string      `json:"backoff,omitempty"` // The wait before the first retry, doubled for each one after. Supports vars.
+	Pin     string      `json:"pin,omitempty"`     // The output pin for routed errors
+	backoff time.Duration
+}
+
+// fails() answers true if an error that gets through me stops the pipeline.
+func (c errorcfg) fails() bool {
+	return c.Policy == "" || c.Policy == ErrorFail || c.Policy == ErrorRetry
+}
+
+// retries() answers the number of times to retry a failed Process.
+func (c errorcfg) retries() int {
+	if c.Policy != ErrorRetry {
+		return 0
+	}
+	return c.Count
+}
+
+// wait() answers the backoff before the retry, where the first retry is 0.
+func (c errorcfg) wait(retry int) time.Duration {
+	return c.backoff << uint(retry)
+}
+
+// ----------------------------------------
+// MISC
+
+// readErrorCfg() reads the optional "onError" setting for the node.
+func readErrorCfg(v interface{}, dst *container, env Environment) error {
+	_e, ok := parse.FindTreeValue("onError", v)
+	if !ok || dst == nil {
+		return nil
+	}
+	cfg := errorcfg{}
+	switch e := _e.(type) {
+	case string:
+		cfg.Policy = ErrorPolicy(e)
+	case map[string]interface{}:
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(b, &cfg)
+		if err != nil {
+			return NewParseError(err)
+		}
+	default:
+		return NewBadRequestError("Invalid onError for node " + dst.name)
+	}
+
+	switch cfg.Policy {
+	case ErrorFail, ErrorContinue:
+	case ErrorRetry:
+		if cfg.Count == 0 {
+			cfg.Count = default_retry_count
+		}
+		if cfg.Backoff == "" {
+			cfg.Backoff = default_retry_backoff
+		}
+		if cfg.Count < 0 {
+			return NewBadRequestError("Invalid onError count for node " + dst.name)
+		}
+		var err error
+		cfg.backoff, err = time.ParseDuration(env.ReplaceVars(cfg.Backoff))
+		if err != nil || cfg.backoff < 0 {
+			return NewBadRequestError("Invalid onError backoff " + cfg.Backoff + " for node " + dst.name)
+		}
+	case ErrorRoute:
+		if cfg.Pin == "" {
+			cfg.Pin = default_error_pin
+		}
+	default:
+		return NewBadRequestError("Unknown onError " + string(cfg.Policy) + " for node " + dst.name)
+	}
+	dst.onError = cfg
+	return nil
+}
+
+// newErrorDoc() answers a doc describing the error, with "code",
+// "message" and "node" headers. The message is also the only item.
+func newErrorDoc(node string, err error) *Doc {
+	code := ProcessErrCode
+	if perr, ok := err.(*PhlyError); ok {
+		code = perr.ErrorCode()
+	}
+	doc := NewStringDoc(err.Error())
+	doc.SetHeader(map[string]interface{}{
+		error_header_code:    code,
+		error_header_message: err.Error(),
+		error_header_node:    node,
+	})
+	return doc
+}
+
+// ----------------------------------------
+// CONST and VAR
+
+const (
+	default_retry_count   = 3
+	default_retry_backoff = "100ms"
+	default_error_pin     = "error"
+
+	error_header_code    = "code"
+	error_header_message = "message"
+	error_header_node    = "node"
+)
@@ -0,0 +1,309 @@
+package phly
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ----------------------------------------
+// PIPELINE-FORMAT
+
+// decodePipelineCfg() decodes the cfg in the format for the file's
+// extension: ".json", ".jsonc" (JSON with comments and trailing commas),
+// or ".yaml" and ".yml". Anything else is read as JSON. Parse errors
+// include the line, and the column if the format reports it.
+func decodePipelineCfg(r io.Reader, filename string, cfg *pipelinecfg) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return decodeYamlCfg(data, cfg)
+	case ".jsonc":
+		data = stripJsonc(data)
+	}
+	return decodeJsonCfg(data, cfg)
+}
+
+func decodeJsonCfg(data []byte, cfg *pipelinecfg) error {
+	err := json.Unmarshal(data, cfg)
+	if err == nil {
+		return nil
+	}
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		line, col := lineCol(data, e.Offset)
+		return NewParseError(&ParseLocationError{line, col, err})
+	case *json.UnmarshalTypeError:
+		line, col := lineCol(data, e.Offset)
+		return NewParseError(&ParseLocationError{line, col, err})
+	}
+	return NewParseError(err)
+}
+
+// decodeYamlCfg() converts the yaml to the same JSON that a JSON file
+// would have, so nodes read their settings the same way in every format.
+// Errors decoding the JSON are reported at the yaml node that caused them.
+func decodeYamlCfg(data []byte, cfg *pipelinecfg) error {
+	var root yaml.Node
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		return NewParseError(yamlLocationError(data, err))
+	}
+	w := &yaml_json_writer{}
+	err = w.write(&root)
+	if err != nil {
+		return NewParseError(err)
+	}
+	err = json.Unmarshal(w.buf.Bytes(), cfg)
+	if err == nil {
+		return nil
+	}
+	msg := errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		err = w.locate(e.Offset, msg)
+	case *json.UnmarshalTypeError:
+		err = w.locate(e.Offset, msg)
+	}
+	return NewParseError(err)
+}
+
+// yamlLocationError() pulls the line out of the yaml error, which looks
+// like "yaml: line 3: mapping values are not allowed in this context".
+// yaml doesn't report the column, so it's where the line's content starts.
+func yamlLocationError(data []byte, err error) error {
+	m := yamlLineRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(m[1])
+	col := 0
+	lines := strings.Split(string(data), "\n")
+	if line > 0 && line <= len(lines) {
+		text := strings.TrimRight(lines[line-1], "\r")
+		if trimmed := strings.TrimLeft(text, " \t"); trimmed != "" {
+			col = len(text) - len(trimmed) + 1
+		}
+	}
+	return &ParseLocationError{Line: line, Col: col, Err: errors.New(m[2])}
+}
+
+// ----------------------------------------
+// YAML-JSON-WRITER
+
+// yaml_json_writer writes a yaml tree as JSON, and remembers where
+// each node was written, so JSON errors can point back to the yaml.
+type yaml_json_writer struct {
+	buf   bytes.Buffer
+	spans []yaml_span
+}
+
+// yaml_span is the JSON written for a single yaml node.
+type yaml_span struct {
+	start, end int64
+	node       *yaml.Node
+}
+
+func (w *yaml_json_writer) write(n *yaml.Node) error {
+	start := int64(w.buf.Len())
+	var err error
+	switch n.Kind {
+	case 0:
+		// An empty document
+		w.buf.WriteString("null")
+	case yaml.DocumentNode:
+		if len(n.Content) < 1 {
+			w.buf.WriteString("null")
+			return nil
+		}
+		return w.write(n.Content[0])
+	case yaml.AliasNode:
+		return w.write(n.Alias)
+	case yaml.MappingNode:
+		w.buf.WriteByte('{')
+		_, err = w.writePairs(n, true)
+		w.buf.WriteByte('}')
+	case yaml.SequenceNode:
+		w.buf.WriteByte('[')
+		for i, c := range n.Content {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			if err = w.write(c); err != nil {
+				break
+			}
+		}
+		w.buf.WriteByte(']')
+	case yaml.ScalarNode:
+		var v interface{}
+		var b []byte
+		if err = n.Decode(&v); err == nil {
+			b, err = json.Marshal(v)
+		}
+		if err != nil {
+			return &ParseLocationError{Line: n.Line, Col: n.Column, Err: err}
+		}
+		w.buf.Write(b)
+	}
+	if err != nil {
+		return err
+	}
+	w.spans = append(w.spans, yaml_span{start, int64(w.buf.Len()), n})
+	return nil
+}
+
+// writePairs() writes the keys and values of the mapping, including any
+// merged with "<<". first is true if the JSON object is still empty, and
+// answered for the pairs after mine.
+func (w *yaml_json_writer) writePairs(n *yaml.Node, first bool) (bool, error) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Tag == "!!merge" {
+			merge := []*yaml.Node{yamlAliased(v)}
+			if merge[0].Kind == yaml.SequenceNode {
+				merge = merge[0].Content
+			}
+			for _, m := range merge {
+				var err error
+				if first, err = w.writePairs(yamlAliased(m), first); err != nil {
+					return first, err
+				}
+			}
+			continue
+		}
+		if !first {
+			w.buf.WriteByte(',')
+		}
+		first = false
+		b, err := json.Marshal(k.Value)
+		if err != nil {
+			return first, err
+		}
+		w.buf.Write(b)
+		w.buf.WriteByte(':')
+		if err = w.write(v); err != nil {
+			return first, err
+		}
+	}
+	return first, nil
+}
+
+// locate() answers the error at the innermost yaml node written
+// around the JSON offset.
+func (w *yaml_json_writer) locate(offset int64, err error) error {
+	var found *yaml_span
+	for i, s := range w.spans {
+		if s.start < offset && offset <= s.end && (found == nil || s.end-s.start < found.end-found.start) {
+			found = &w.spans[i]
+		}
+	}
+	if found == nil {
+		return err
+	}
+	return &ParseLocationError{Line: found.node.Line, Col: found.node.Column, Err: err}
+}
+
+// stripJsonc() answers the JSON with comments and trailing commas
+// replaced by spaces. Newlines are kept, so errors point to the
+// same line and column in the original.
+func stripJsonc(src []byte) []byte {
+	dst := append([]byte{}, src...)
+	blank := func(from, to int) {
+		for i := from; i < to && i < len(dst); i++ {
+			if dst[i] != '\n' && dst[i] != '\r' {
+				dst[i] = ' '
+			}
+		}
+	}
+	// Comments
+	for i := 0; i < len(dst); i++ {
+		switch {
+		case dst[i] == '"':
+			i = skipJsonString(dst, i)
+		case dst[i] == '/' && i+1 < len(dst) && dst[i+1] == '/':
+			end := i
+			for end < len(dst) && dst[end] != '\n' {
+				end++
+			}
+			blank(i, end)
+			i = end
+		case dst[i] == '/' && i+1 < len(dst) && dst[i+1] == '*':
+			end := strings.Index(string(dst[i+2:]), "*/")
+			if end < 0 {
+				// Leave it for the decoder to report
+				return dst
+			}
+			end += i + 4
+			blank(i, end)
+			i = end - 1
+		}
+	}
+	// Trailing commas
+	for i := 0; i < len(dst); i++ {
+		switch dst[i] {
+		case '"':
+			i = skipJsonString(dst, i)
+		case ',':
+			next := i + 1
+			for next < len(dst) && strings.IndexByte(" \t\r\n", dst[next]) >= 0 {
+				next++
+			}
+			if next < len(dst) && (dst[next] == '}' || dst[next] == ']') {
+				dst[i] = ' '
+			}
+		}
+	}
+	return dst
+}
+
+// skipJsonString() answers the index of the quote that ends the string starting at i.
+func skipJsonString(data []byte, i int) int {
+	for i++; i < len(data); i++ {
+		if data[i] == '\\' {
+			i++
+		} else if data[i] == '"' {
+			return i
+		}
+	}
+	return i
+}
+
+// lineCol() answers the line and column of the byte before offset,
+// which is where encoding/json reports its errors.
+func lineCol(data []byte, offset int64) (int, int) {
+	if offset < 1 {
+		return 1, 1
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := string(data[:offset-1])
+	line := strings.Count(before, "\n") + 1
+	col := len(before) - strings.LastIndex(before, "\n")
+	return line, col
+}
+
+// yamlAliased() answers the node an alias refers to, or the node.
+func yamlAliased(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	return n
+}
+
+// ----------------------------------------
+// CONST and VAR
+
+var (
+	yamlLineRegexp = regexp.MustCompile(`(?s)^yaml: line (\d+): (.*)$`)
+)
@@ -1,310 +1,545 @@
-package phly
-
-import (
-	"encoding/json"
-	"errors"
-	"github.com/micro-go/parse"
-	"io"
-	"os"
-	"path/filepath"
-	"strings"
-)
-
-func LoadPipeline(name string) (Pipeline, error) {
-	filename := env.FindFile(name)
-	f, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	return ReadPipeline(f)
-}
-
-func ReadPipeline(r io.Reader) (Pipeline, error) {
-	p := &pipeline{}
-	err := readPipeline(r, p)
-	return p, err
-}
-
-func readPipeline(r io.Reader, p *pipeline) error {
-	p.workingdir = workingDirFrom(r)
-
-	d := json.NewDecoder(r)
-	cfg := &pipelinecfg{}
-	err := d.Decode(cfg)
-	if err != nil {
-		return NewParseError(err)
-	}
-	cfg.applyEnvVarsToPins()
-	//	fmt.Println("LOADED", cfg)
-	if len(cfg.Nodes) < 1 {
-		return NewBadRequestError("No nodes")
-	}
-	p.inputDescr = makePipelinePinDescrs(cfg.Ins)
-	p.outputDescr = makePipelinePinDescrs(cfg.Outs)
-	node_ins := make(map[string][]pincfg)
-	node_outs := make(map[string][]pincfg)
-
-	// Read the args
-	args, err := cfg.Args.asArgs()
-	if err != nil {
-		return err
-	}
-	p.args = args
-
-	// Create the nodes and cache their pins
-	for k, v := range cfg.Nodes {
-		n, err := readNode(k, v)
-		if err != nil {
-			return err
-		}
-		err = MergeErrors(err, p.add(k, n))
-		err = MergeErrors(err, readPinCfgsTo("outs", v, k, node_outs))
-		err = MergeErrors(err, readPinCfgsTo("ins", v, k, node_ins))
-		if err != nil {
-			return err
-		}
-	}
-
-	// Apply the out pins
-	for k, pinlist := range node_outs {
-		srcn, ok := p.nodes[k]
-		if !ok || srcn == nil {
-			return errors.New("Pin on missing node " + k)
-		}
-		for _, pin := range pinlist {
-			dstn, ok := p.nodes[pin.dstNode]
-			if !ok || dstn == nil {
-				return errors.New("Pin on missing node " + pin.dstNode)
-			}
-			err = srcn.connect(pin.srcPin, dstn, pin.dstPin)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	// Apply the in pins
-	// NOTE: Currently just used for connecting pipelines to the args list.
-	for k, pinlist := range node_ins {
-		srcn, ok := p.nodes[k]
-		if !ok || srcn == nil {
-			return errors.New("Pin on missing node " + k)
-		}
-		for _, pin := range pinlist {
-			if pin.dstNode == args_container.name {
-				err = MergeErrors(err, p.addInput(pin.srcPin, args_container, pin.dstPin))
-				err = MergeErrors(err, srcn.connectInput(pin.srcPin, args_container, pin.dstPin))
-			} else if pin.dstNode == pipeline_container.name {
-				err = MergeErrors(err, p.addInput(pin.srcPin, pipeline_container, pin.dstPin))
-				err = MergeErrors(err, srcn.connectInput(pin.srcPin, pipeline_container, pin.dstPin))
-			} else {
-				return NewIllegalError("Input pin " + k + "->" + pin.srcPin + " is " + pin.dstNode + " but can only be " + args_container.name + " or " + pipeline_container.name)
-			}
-		}
-	}
-	if err != nil {
-		return err
-	}
-
-	// Hookup my inputs. They point to an empty container, since there's no
-	// container for the pipeline. Inputs aren't traversed so this is fine.
-	empty_container := &container{node: p}
-	for _, descr := range p.inputDescr {
-		for _, conn := range descr.connections {
-			dstn, ok := p.nodes[conn.DstNode]
-			if !ok || dstn == nil {
-				return errors.New("Pipeline input pin on missing node " + conn.DstNode)
-			}
-			dstn.inputs = append(dstn.inputs, connection{conn.DstPin, empty_container, descr.Name})
-		}
-	}
-
-	// Validate
-	return p.validate()
-}
-
-// --------------------------------
-// PIPELINE-CFG
-
-type pipelinecfg struct {
-	Args  pipeline_args_io       `json:"args,omitempty"`
-	Ins   map[string][]string    `json:"ins,omitempty"`
-	Outs  map[string][]string    `json:"outs,omitempty"`
-	Nodes map[string]interface{} `json:"nodes,omitempty"`
-}
-
-func (p *pipelinecfg) applyEnvVarsToPins() {
-	// Replace any pin names with environment variables. Note this is only
-	// the names, and used for doing things like allowing different values
-	// for different platforms.
-	p.applyEnvVarsToNodes()
-	applyEnvVarsToSingle(p.Args.Strings)
-	applyEnvVarsToMultiple(p.Ins)
-	applyEnvVarsToMultiple(p.Outs)
-}
-
-func (p *pipelinecfg) applyEnvVarsToNodes() {
-	for _, n := range p.Nodes {
-		applyEnvVarsToSingle(treeMapStrings("ins", n))
-		applyEnvVarsToSingle(treeMapStrings("outs", n))
-	}
-}
-
-func applyEnvVarsToSingle(m map[string]interface{}) {
-	if m == nil {
-		return
-	}
-	for k, v := range m {
-		newk := env.ReplaceVars(k, nil)
-		newv, changed := applyEnvVarsToInterface(v)
-		if changed || newk != k {
-			delete(m, k)
-			m[newk] = newv
-		}
-	}
-}
-
-func applyEnvVarsToMultiple(m map[string][]string) {
-	if m == nil {
-		return
-	}
-	for k, v := range m {
-		newk := env.ReplaceVars(k, nil)
-		if newk != k {
-			delete(m, k)
-			m[newk] = v
-		}
-	}
-}
-
-// applyEnvVarsToInterface() applies the environment variables to an unknown type,
-// answering the new value and true if it changed.
-func applyEnvVarsToInterface(_v interface{}) (interface{}, bool) {
-	switch v := _v.(type) {
-	case string:
-		newv := env.ReplaceVars(v, nil)
-		if v != newv {
-			return newv, true
-		}
-	}
-	return _v, false
-}
-
-func makePipelinePinDescrs(src map[string][]string) []pipelinePinDescr {
-	var dst []pipelinePinDescr
-	for k, v := range src {
-		descr := pipelinePinDescr{}
-		descr.Name = k
-		for _, vv := range v {
-			descr.connections = append(descr.connections, newConnectionDescr(vv))
-		}
-		dst = append(dst, descr)
-	}
-	return dst
-}
-
-func treeMapStrings(path string, tree interface{}) map[string]interface{} {
-	if tree == nil {
-		return nil
-	}
-	_v, err := parse.TreeValue(path, tree)
-	if err != nil {
-		return nil
-	}
-	if v, ok := _v.(map[string]interface{}); ok {
-		return v
-	}
-	return nil
-}
-
-// --------------------------------
-// PIPELINE-ARGS-IO
-
-type pipeline_args_io struct {
-	Env     string                 `json:"env,omitempty"`
-	Strings map[string]interface{} `json:"strings,omitempty"`
-}
-
-func (p pipeline_args_io) asArgs() (pipeline_args, error) {
-	a := &pipeline_args{env: p.Env}
-	err := a.make(string_format, p.Strings)
-	return *a, err
-}
-
-// --------------------------------
-// PIN-CFG
-
-type pincfg struct {
-	srcPin  string
-	dstNode string
-	dstPin  string
-}
-
-// --------------------------------
-// MISC
-
-func readNode(k string, v interface{}) (Node, error) {
-	name, _ := parse.FindTreeString("node", v)
-	if name == "" {
-		return nil, NewMissingError("Node " + k)
-	}
-	if !isLegalNodeName(name) {
-		return nil, NewIllegalError("Node " + name)
-	}
-	cfg, _ := parse.FindTreeValue("cfg", v)
-	n, err := reg.instantiate(name, cfg)
-	return n, err
-}
-
-func readPinCfgsTo(name string, v interface{}, dstkey string, dst map[string][]pincfg) error {
-	pc, err := readPinCfgs(name, v)
-	if err != nil {
-		return err
-	}
-	if pc != nil {
-		dst[dstkey] = pc
-	}
-	return nil
-}
-
-func readPinCfgs(name string, v interface{}) ([]pincfg, error) {
-	_pc, ok := parse.FindTreeValue(name, v)
-	if !ok {
-		// No pins are valid
-		return nil, nil
-	}
-	pc, ok := _pc.(map[string]interface{})
-	if !ok {
-		return nil, wrongFormatPinsErr
-	}
-	var ans []pincfg
-	for k, _v := range pc {
-		v, ok := _v.(string)
-		if !ok {
-			return nil, wrongFormatPinsErr
-		}
-		parts := strings.Split(v, ":")
-		if len(parts) != 2 {
-			return nil, wrongFormatPinsErr
-		}
-		ans = append(ans, pincfg{k, parts[0], parts[1]})
-	}
-	return ans, nil
-}
-
-func isLegalNodeName(name string) bool {
-	switch strings.ToLower(name) {
-	case
-		"ins", "outs", "args":
-		return false
-	}
-	return true
-}
-
-func workingDirFrom(r io.Reader) string {
-	if n, ok := r.(namer); ok && n != nil {
-		return filepath.Dir(n.Name())
-	}
-	return ""
-}
+package phly
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/micro-go/parse"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadPipeline() loads the named pipeline with the default engine.
+func LoadPipeline(name string) (Pipeline, error) {
+	return defaultEngine.LoadPipeline(name)
+}
+
+// ReadPipeline() reads the pipeline with the default engine.
+func ReadPipeline(r io.Reader) (Pipeline, error) {
+	return defaultEngine.ReadPipeline(r)
+}
+
+// WritePipeline() writes the pipeline as JSON, in the same format
+// ReadPipeline() reads. Node cfgs are written as they were read, so
+// any vars in them are kept.
+func WritePipeline(w io.Writer, _p Pipeline) error {
+	p, ok := _p.(*pipeline)
+	if !ok || p == nil {
+		return NewBadRequestError("Can't write pipeline")
+	}
+	data, err := json.MarshalIndent(p.makeCfg(), "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func readPipeline(r io.Reader, p *pipeline) error {
+	p.workingdir = workingDirFrom(r)
+	if n, ok := r.(namer); ok && n != nil && p.file == "" {
+		p.file = n.Name()
+	}
+
+	cfg := &pipelinecfg{}
+	err := decodePipelineCfg(r, p.file, cfg)
+	if err != nil {
+		return err
+	}
+	return readPipelineCfg(cfg, p)
+}
+
+// readPipelineCfg() builds the pipeline from the decoded cfg. problems
+// are found before the cfg, and reported with the rest by validate().
+func readPipelineCfg(cfg *pipelinecfg, p *pipeline, problems ...ValidateProblem) error {
+	var err error
+	e := p.getEngine()
+	p.engine = e
+	cfg.applyEnvVarsToPins(e.env)
+	//	fmt.Println("LOADED", cfg)
+	if len(cfg.Nodes) < 1 {
+		return NewBadRequestError("No nodes")
+	}
+	if cfg.Timeout != "" {
+		p.timeout, err = time.ParseDuration(e.env.ReplaceVars(cfg.Timeout))
+		if err != nil {
+			return NewBadRequestError("Invalid timeout " + cfg.Timeout)
+		}
+	}
+	p.workers, err = readWorkers(cfg.Workers, e.env)
+	if err != nil {
+		return err
+	}
+	if cfg.Queue != nil {
+		p.queue = *cfg.Queue
+	}
+	err = p.queue.validate()
+	if err != nil {
+		return err
+	}
+	p.inputDescr = makePipelinePinDescrs(cfg.Ins)
+	p.outputDescr = makePipelinePinDescrs(cfg.Outs)
+	node_ins := make(map[string][]pincfg)
+	node_outs := make(map[string][]pincfg)
+
+	// Read the args
+	args, err := cfg.Args.asArgs()
+	if err != nil {
+		return err
+	}
+	p.args = args
+
+	// Create the nodes and cache their pins
+	for k, v := range cfg.Nodes {
+		n, err := readNode(e, k, v)
+		if err != nil {
+			return err
+		}
+		err = MergeErrors(err, p.add(k, n))
+		if c := p.nodes[k]; c != nil {
+			c.cfg, _ = parse.FindTreeValue("cfg", v)
+		}
+		err = MergeErrors(err, readQueueCfg(v, p.nodes[k]))
+		err = MergeErrors(err, readErrorCfg(v, p.nodes[k], e.env))
+		err = MergeErrors(err, readLoopCfg(v, p.nodes[k], e.env))
+		err = MergeErrors(err, readPinCfgsTo("outs", v, k, node_outs))
+		err = MergeErrors(err, readPinCfgsTo("ins", v, k, node_ins))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Apply the out pins
+	for k, pinlist := range node_outs {
+		srcn, ok := p.nodes[k]
+		if !ok || srcn == nil {
+			return errors.New("Pin on missing node " + k)
+		}
+		for _, pin := range pinlist {
+			dstn, ok := p.nodes[pin.dstNode]
+			if !ok || dstn == nil {
+				problems = append(problems, ValidateProblem{Node: k, Pin: pin.srcPin, Msg: "Output to missing node " + pin.dstNode})
+				continue
+			}
+			err = srcn.connect(pin.srcPin, dstn, pin.dstPin)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Apply the in pins
+	// NOTE: Currently just used for connecting pipelines to the args list.
+	for k, pinlist := range node_ins {
+		srcn, ok := p.nodes[k]
+		if !ok || srcn == nil {
+			return errors.New("Pin on missing node " + k)
+		}
+		for _, pin := range pinlist {
+			if pin.dstNode == args_container.name {
+				err = MergeErrors(err, p.addInput(pin.srcPin, args_container, pin.dstPin))
+				err = MergeErrors(err, srcn.connectInput(pin.srcPin, args_container, pin.dstPin))
+			} else if pin.dstNode == pipeline_container.name {
+				err = MergeErrors(err, p.addInput(pin.srcPin, pipeline_container, pin.dstPin))
+				err = MergeErrors(err, srcn.connectInput(pin.srcPin, pipeline_container, pin.dstPin))
+			} else {
+				problems = append(problems, ValidateProblem{Node: k, Pin: pin.srcPin, Msg: "Input from " + pin.dstNode + " but can only be " + args_container.name + " or " + pipeline_container.name})
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Hookup my inputs. They point to an empty container, since there's no
+	// container for the pipeline. Inputs aren't traversed so this is fine.
+	// Missing nodes are reported by validate().
+	empty_container := &container{node: p}
+	for _, descr := range p.inputDescr {
+		for _, conn := range descr.connections {
+			dstn, ok := p.nodes[conn.DstNode]
+			if !ok || dstn == nil {
+				continue
+			}
+			dstn.inputs = append(dstn.inputs, connection{conn.DstPin, empty_container, descr.Name})
+		}
+	}
+
+	// Hookup my outputs. Each connection names the node and pin that
+	// feeds the output, which the runner collects as the pipeline result.
+	for _, descr := range p.outputDescr {
+		for _, conn := range descr.connections {
+			srcn, ok := p.nodes[conn.DstNode]
+			if !ok || srcn == nil {
+				continue
+			}
+			err = srcn.connectOutput(conn.DstPin, pipeline_container, descr.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Validate
+	return p.validate(problems...)
+}
+
+// --------------------------------
+// PIPELINE-CFG
+
+type pipelinecfg struct {
+	Timeout string                 `json:"timeout,omitempty"`
+	Workers interface{}            `json:"workers,omitempty"`
+	Queue   *queuecfg              `json:"queue,omitempty"`
+	Args    *pipeline_args_io      `json:"args,omitempty"`
+	Ins     map[string][]string    `json:"ins,omitempty"`
+	Outs    map[string][]string    `json:"outs,omitempty"`
+	Nodes   map[string]interface{} `json:"nodes,omitempty"`
+}
+
+// makeCfg() answers the cfg that reads back into my graph.
+func (p *pipeline) makeCfg() *pipelinecfg {
+	cfg := &pipelinecfg{Nodes: make(map[string]interface{})}
+	if queue := p.queue; queue != (queuecfg{}) {
+		cfg.Queue = &queue
+	}
+	if p.workers != "" {
+		cfg.Workers = p.workers
+	}
+	if p.timeout > 0 {
+		cfg.Timeout = p.timeout.String()
+	}
+	if p.args.env != "" || len(p.args.args) > 0 {
+		cfg.Args = &pipeline_args_io{Env: p.args.env}
+		for k, a := range p.args.args {
+			if a.typed() {
+				if cfg.Args.Typed == nil {
+					cfg.Args.Typed = make(map[string]argcfg)
+				}
+				cfg.Args.Typed[k] = a.asCfg()
+				continue
+			}
+			if cfg.Args.Strings == nil {
+				cfg.Args.Strings = make(map[string]interface{})
+			}
+			cfg.Args.Strings[k] = a.value
+		}
+	}
+	cfg.Ins = makePipelinePinCfgs(p.inputDescr)
+	cfg.Outs = makePipelinePinCfgs(p.outputDescr)
+	for k, c := range p.nodes {
+		n := nodecfg{Node: c.node.Describe().Id, Cfg: c.cfg, MaxIterations: c.maxIterations}
+		if queue := c.queue; queue != (queuecfg{}) {
+			n.Queue = &queue
+		}
+		if onError := c.onError; onError.Policy != "" {
+			n.OnError = &onError
+		}
+		for _, con := range c.inputs {
+			// Only inputs from the args and pipeline are written, the
+			// rest are the outputs of other nodes.
+			if con.dstNode == args_container || con.dstNode == pipeline_container {
+				if n.Ins == nil {
+					n.Ins = make(map[string]string)
+				}
+				n.Ins[con.srcPin] = con.dstNode.name + ":" + con.dstPin
+			}
+		}
+		for _, con := range c.outputs {
+			// Outputs to the pipeline are written in its outs.
+			if con.dstNode == nil || con.dstNode == pipeline_container {
+				continue
+			}
+			if n.Outs == nil {
+				n.Outs = make(map[string][]string)
+			}
+			n.Outs[con.srcPin] = append(n.Outs[con.srcPin], con.dstNode.name+":"+con.dstPin)
+		}
+		cfg.Nodes[k] = n
+	}
+	return cfg
+}
+
+func (p *pipelinecfg) applyEnvVarsToPins(env Environment) {
+	// Replace any pin names with environment variables. Note this is only
+	// the names, and used for doing things like allowing different values
+	// for different platforms.
+	p.applyEnvVarsToNodes(env)
+	if p.Args != nil {
+		applyEnvVarsToSingle(env, p.Args.Strings)
+	}
+	applyEnvVarsToMultiple(env, p.Ins)
+	applyEnvVarsToMultiple(env, p.Outs)
+}
+
+func (p *pipelinecfg) applyEnvVarsToNodes(env Environment) {
+	for _, n := range p.Nodes {
+		applyEnvVarsToSingle(env, treeMapStrings("ins", n))
+		applyEnvVarsToSingle(env, treeMapStrings("outs", n))
+	}
+}
+
+func applyEnvVarsToSingle(env Environment, m map[string]interface{}) {
+	if m == nil {
+		return
+	}
+	for k, v := range m {
+		newk := env.ReplaceVars(k, nil)
+		newv, changed := applyEnvVarsToInterface(env, v)
+		if changed || newk != k {
+			delete(m, k)
+			m[newk] = newv
+		}
+	}
+}
+
+func applyEnvVarsToMultiple(env Environment, m map[string][]string) {
+	if m == nil {
+		return
+	}
+	for k, v := range m {
+		newk := env.ReplaceVars(k, nil)
+		if newk != k {
+			delete(m, k)
+			m[newk] = v
+		}
+	}
+}
+
+// applyEnvVarsToInterface() applies the environment variables to an unknown type,
+// answering the new value and true if it changed.
+func applyEnvVarsToInterface(env Environment, _v interface{}) (interface{}, bool) {
+	switch v := _v.(type) {
+	case string:
+		newv := env.ReplaceVars(v, nil)
+		if v != newv {
+			return newv, true
+		}
+	case []interface{}:
+		changed := false
+		for i, vv := range v {
+			newvv, c := applyEnvVarsToInterface(env, vv)
+			if c {
+				v[i] = newvv
+				changed = true
+			}
+		}
+		return v, changed
+	}
+	return _v, false
+}
+
+func makePipelinePinDescrs(src map[string][]string) []pipelinePinDescr {
+	var dst []pipelinePinDescr
+	for k, v := range src {
+		descr := pipelinePinDescr{}
+		descr.Name = k
+		for _, vv := range v {
+			descr.connections = append(descr.connections, newConnectionDescr(vv))
+		}
+		dst = append(dst, descr)
+	}
+	return dst
+}
+
+func makePipelinePinCfgs(src []pipelinePinDescr) map[string][]string {
+	if len(src) < 1 {
+		return nil
+	}
+	dst := make(map[string][]string)
+	for _, descr := range src {
+		dst[descr.Name] = []string{}
+		for _, conn := range descr.connections {
+			dst[descr.Name] = append(dst[descr.Name], conn.DstNode+":"+conn.DstPin)
+		}
+	}
+	return dst
+}
+
+func treeMapStrings(path string, tree interface{}) map[string]interface{} {
+	if tree == nil {
+		return nil
+	}
+	_v, err := parse.TreeValue(path, tree)
+	if err != nil {
+		return nil
+	}
+	if v, ok := _v.(map[string]interface{}); ok {
+		return v
+	}
+	return nil
+}
+
+// --------------------------------
+// NODE-CFG
+
+// nodecfg is a single node in the pipeline file, used when writing.
+// Reading uses the generic tree, so nodes can be parsed piece by piece.
+type nodecfg struct {
+	Node          string              `json:"node"`
+	Cfg           interface{}         `json:"cfg,omitempty"`
+	Queue         *queuecfg           `json:"queue,omitempty"`
+	OnError       *errorcfg           `json:"onError,omitempty"`
+	MaxIterations int                 `json:"maxIterations,omitempty"`
+	Ins           map[string]string   `json:"ins,omitempty"`
+	Outs          map[string][]string `json:"outs,omitempty"`
+}
+
+// --------------------------------
+// PIPELINE-ARGS-IO
+
+type pipeline_args_io struct {
+	Env     string                 `json:"env,omitempty"`
+	Strings map[string]interface{} `json:"strings,omitempty"`
+	Typed   map[string]argcfg      `json:"typed,omitempty"` // Args with a type, description, or other settings
+}
+
+func (p *pipeline_args_io) asArgs() (pipeline_args, error) {
+	if p == nil {
+		return pipeline_args{}, nil
+	}
+	a := &pipeline_args{env: p.Env}
+	err := a.make(string_format, p.Strings)
+	err = MergeErrors(err, a.makeTyped(p.Typed))
+	return *a, err
+}
+
+// --------------------------------
+// PIN-CFG
+
+type pincfg struct {
+	srcPin  string
+	dstNode string
+	dstPin  string
+}
+
+// --------------------------------
+// MISC
+
+// readWorkers() answers the workers setting, which can be a number or a string
+// that solves to a number, such as "${cpus}".
+func readWorkers(v interface{}, env Environment) (string, error) {
+	var workers string
+	switch w := v.(type) {
+	case nil:
+		return "", nil
+	case float64:
+		workers = strconv.Itoa(int(w))
+	case string:
+		workers = w
+	default:
+		return "", NewBadRequestError("Invalid workers")
+	}
+	n, err := parse.SolveInt(env.ReplaceVars(workers))
+	if err != nil || n < 1 {
+		return "", NewBadRequestError("Invalid workers " + workers)
+	}
+	return workers, nil
+}
+
+func readNode(e *Engine, k string, v interface{}) (Node, error) {
+	name, _ := parse.FindTreeString("node", v)
+	if name == "" {
+		return nil, NewMissingError("Node " + k)
+	}
+	if !isLegalNodeName(name) {
+		return nil, NewIllegalError("Node " + name)
+	}
+	cfg, _ := parse.FindTreeValue("cfg", v)
+	n, err := e.instantiate(name, cfg)
+	return n, err
+}
+
+// readQueueCfg() reads the optional queue settings for the node.
+func readQueueCfg(v interface{}, dst *container) error {
+	_q, ok := parse.FindTreeValue("queue", v)
+	if !ok || dst == nil {
+		return nil
+	}
+	b, err := json.Marshal(_q)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, &dst.queue)
+	if err != nil {
+		return NewParseError(err)
+	}
+	return dst.queue.validate()
+}
+
+func readPinCfgsTo(name string, v interface{}, dstkey string, dst map[string][]pincfg) error {
+	pc, err := readPinCfgs(name, v)
+	if err != nil {
+		return err
+	}
+	if pc != nil {
+		dst[dstkey] = pc
+	}
+	return nil
+}
+
+func readPinCfgs(name string, v interface{}) ([]pincfg, error) {
+	_pc, ok := parse.FindTreeValue(name, v)
+	if !ok {
+		// No pins are valid
+		return nil, nil
+	}
+	pc, ok := _pc.(map[string]interface{})
+	if !ok {
+		return nil, wrongFormatPinsErr
+	}
+	var ans []pincfg
+	for k, _v := range pc {
+		// A pin can be connected to a single destination or an array of them.
+		switch v := _v.(type) {
+		case string:
+			cfg, err := newPinCfg(k, v)
+			if err != nil {
+				return nil, err
+			}
+			ans = append(ans, cfg)
+		case []interface{}:
+			for _, _vv := range v {
+				vv, ok := _vv.(string)
+				if !ok {
+					return nil, wrongFormatPinsErr
+				}
+				cfg, err := newPinCfg(k, vv)
+				if err != nil {
+					return nil, err
+				}
+				ans = append(ans, cfg)
+			}
+		default:
+			return nil, wrongFormatPinsErr
+		}
+	}
+	return ans, nil
+}
+
+// newPinCfg() answers a pincfg from the pin name and a "node:pin" destination.
+func newPinCfg(srcpin, dst string) (pincfg, error) {
+	parts := strings.Split(dst, ":")
+	if len(parts) != 2 {
+		return pincfg{}, wrongFormatPinsErr
+	}
+	return pincfg{srcpin, parts[0], parts[1]}, nil
+}
+
+func isLegalNodeName(name string) bool {
+	switch strings.ToLower(name) {
+	case
+		"ins", "outs", "args":
+		return false
+	}
+	return true
+}
+
+func workingDirFrom(r io.Reader) string {
+	if n, ok := r.(namer); ok && n != nil {
+		return filepath.Dir(n.Name())
+	}
+	return ""
+}
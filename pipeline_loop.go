@@ -0,0 +1,179 @@
+package phly
+
+import (
+	"github.com/micro-go/lock"
+	"github.com/micro-go/parse"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ----------------------------------------
+// LOOPS
+
+// A pipeline can contain cycles, where a node's output feeds a node
+// upstream of it, such as a retry or poll loop. Every cycle must pass
+// through a node with a "maxIterations" setting, which is the number of
+// times that node's output can be sent back around the cycle. Once the
+// limit is reached, further output along the cycle is dropped, which
+// ends the loop. Output from the same node that leaves the cycle is
+// never limited.
+
+// readLoopCfg() reads the optional "maxIterations" setting for the node.
+func readLoopCfg(v interface{}, dst *container, env Environment) error {
+	_m, ok := parse.FindTreeValue("maxIterations", v)
+	if !ok || dst == nil {
+		return nil
+	}
+	var m int
+	switch t := _m.(type) {
+	case float64:
+		m = int(t)
+	case string:
+		n, err := parse.SolveInt(env.ReplaceVars(t))
+		if err != nil {
+			return NewBadRequestError("Invalid maxIterations for node " + dst.name)
+		}
+		m = n
+	}
+	if m < 1 {
+		return NewBadRequestError("Invalid maxIterations for node " + dst.name)
+	}
+	dst.maxIterations = m
+	return nil
+}
+
+// validateLoops() finds the edges that close a cycle from a node with
+// maxIterations, and answers the nodes in any cycle that has no limit.
+func (p *pipeline) validateLoops() []string {
+	p.loops = make(map[connection_key]int)
+	limited := make(map[*container]map[connection]struct{})
+	for _, c := range p.nodes {
+		if c.maxIterations < 1 {
+			continue
+		}
+		for _, con := range c.outputs {
+			if con.dstNode != nil && p.reaches(con.dstNode, c) {
+				key := connection_key{c.name, con.srcPin, con.dstNode.name, con.dstPin}
+				p.loops[key] = c.maxIterations
+				if limited[c] == nil {
+					limited[c] = make(map[connection]struct{})
+				}
+				limited[c][con] = struct{}{}
+			}
+		}
+	}
+	// With the limited edges removed, the graph must have no cycles.
+	return p.findCycle(func(c *container, con connection) bool {
+		_, ok := limited[c][con]
+		return !ok
+	})
+}
+
+// reaches() answers true if there's a path from the src node to the dst node.
+func (p *pipeline) reaches(src, dst *container) bool {
+	visited := make(map[*container]struct{})
+	pending := []*container{src}
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if c == dst {
+			return true
+		}
+		if _, ok := visited[c]; ok {
+			continue
+		}
+		visited[c] = struct{}{}
+		for _, con := range c.outputs {
+			if con.dstNode != nil && p.nodes[con.dstNode.name] == con.dstNode {
+				pending = append(pending, con.dstNode)
+			}
+		}
+	}
+	return false
+}
+
+// findCycle() answers the names of the nodes in a cycle, using only the
+// edges the follow func accepts, or nil if there are no cycles.
+func (p *pipeline) findCycle(follow func(*container, connection) bool) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*container]int)
+	var path []string
+	var visit func(c *container) []string
+	visit = func(c *container) []string {
+		state[c] = visiting
+		path = append(path, c.name)
+		for _, con := range c.outputs {
+			dst := con.dstNode
+			if dst == nil || p.nodes[dst.name] != dst || !follow(c, con) {
+				continue
+			}
+			switch state[dst] {
+			case visiting:
+				for i, name := range path {
+					if name == dst.name {
+						return append(append([]string{}, path[i:]...), dst.name)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dst); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[c] = visited
+		return nil
+	}
+
+	var names []string
+	for name := range p.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if c := p.nodes[name]; state[c] == unvisited {
+			if cycle := visit(c); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// ----------------------------------------
+// LOOP-COUNTER
+
+// loop_counter counts the output sent along each limited edge in a run.
+type loop_counter struct {
+	mutex  sync.Mutex
+	limits map[connection_key]int
+	counts map[connection_key]int
+}
+
+func newLoopCounter(limits map[connection_key]int) *loop_counter {
+	return &loop_counter{limits: limits, counts: make(map[connection_key]int)}
+}
+
+// next() answers true if output can be sent along the edge, counting it.
+func (c *loop_counter) next(key connection_key) bool {
+	limit, ok := c.limits[key]
+	if !ok {
+		return true
+	}
+	defer lock.Locker(&c.mutex).Unlock()
+	if c.counts[key] >= limit {
+		return false
+	}
+	c.counts[key]++
+	return true
+}
+
+// loopLimitErr() answers the error traced when output is dropped at the limit.
+func loopLimitErr(c connection_key, limit int) error {
+	return NewOverflowError("Loop " + c.srcNode + ":" + c.srcPin + " -> " + c.dstNode + ":" + c.dstPin + " reached maxIterations " + strconv.Itoa(limit))
+}
@@ -0,0 +1,119 @@
+package phly
+
+import (
+	"encoding/json"
+	"github.com/micro-go/lock"
+	"sort"
+	"sync"
+)
+
+// ----------------------------------------
+// PIPELINE-PLAN
+
+// PipelinePlan describes what a pipeline would do. It is
+// produced by a dry run, where nodes report their actions
+// with ProcessArgs.PlanAction() instead of performing them.
+type PipelinePlan struct {
+	Args  map[string]interface{} `json:"args,omitempty"` // The pipeline args, resolved from the env and command line
+	Nodes []NodePlan             `json:"nodes"`          // Sorted by name
+}
+
+// NodePlan describes a single node in the plan.
+type NodePlan struct {
+	Name    string      `json:"name"`
+	Id      string      `json:"id"`
+	Cfg     interface{} `json:"cfg,omitempty"`     // The node's cfg, with vars and defaults resolved
+	Actions []string    `json:"actions,omitempty"` // What the node would have done
+}
+
+// ----------------------------------------
+// RUN-PLAN
+
+// run_plan collects the actions nodes report during a run.
+type run_plan struct {
+	mutex   sync.Mutex
+	actions map[string][]string
+}
+
+func newRunPlan() *run_plan {
+	return &run_plan{actions: make(map[string][]string)}
+}
+
+func (p *run_plan) add(node, action string) {
+	defer lock.Locker(&p.mutex).Unlock()
+	p.actions[node] = append(p.actions[node], action)
+}
+
+// get() answers the plan for every node in the pipeline.
+func (p *run_plan) get(pl *pipeline, args ProcessArgs) PipelinePlan {
+	defer lock.Locker(&p.mutex).Unlock()
+	ans := PipelinePlan{}
+	for name := range pl.args.args {
+		if doc, _ := pl.args.valueDoc(args, name); doc != nil && len(doc.Items) > 0 {
+			if ans.Args == nil {
+				ans.Args = make(map[string]interface{})
+			}
+			ans.Args[name] = doc.Items[0]
+		}
+	}
+	for name, c := range pl.nodes {
+		n := NodePlan{Name: name, Id: c.node.Describe().Id, Cfg: nodeCfg(c.node, args.env)}
+		n.Actions = append(n.Actions, p.actions[name]...)
+		ans.Nodes = append(ans.Nodes, n)
+	}
+	sort.Sort(sortNodePlans(ans.Nodes))
+	return ans
+}
+
+// ----------------------------------------
+// MISC
+
+// nodeCfg() answers the node's cfg, which is all of its json-tagged
+// fields, or nil if it has none. Vars in any string are replaced.
+func nodeCfg(n Node, env Environment) interface{} {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return nil
+	}
+	var cfg interface{}
+	err = json.Unmarshal(b, &cfg)
+	if m, ok := cfg.(map[string]interface{}); err != nil || (ok && len(m) < 1) {
+		return nil
+	}
+	return replaceCfgVars(cfg, env)
+}
+
+// replaceCfgVars() answers the cfg tree with the vars replaced in every string.
+func replaceCfgVars(_v interface{}, env Environment) interface{} {
+	if env == nil {
+		return _v
+	}
+	switch v := _v.(type) {
+	case string:
+		return env.ReplaceVars(v)
+	case map[string]interface{}:
+		for k, vv := range v {
+			v[k] = replaceCfgVars(vv, env)
+		}
+	case []interface{}:
+		for i, vv := range v {
+			v[i] = replaceCfgVars(vv, env)
+		}
+	}
+	return _v
+}
+
+// ----------------------------------------
+// SORT
+
+type sortNodePlans []NodePlan
+
+func (s sortNodePlans) Len() int {
+	return len(s)
+}
+func (s sortNodePlans) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortNodePlans) Less(i, j int) bool {
+	return s[i].Name < s[j].Name
+}
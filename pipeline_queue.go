@@ -0,0 +1,219 @@
+package phly
+
+import (
+	"container/list"
+	"github.com/micro-go/lock"
+	"sync"
+)
+
+// ----------------------------------------
+// QUEUE-CFG
+
+// OverflowPolicy determines what happens when input arrives
+// on an edge that is already at capacity.
+type OverflowPolicy string
+
+const (
+	OverflowBlock      OverflowPolicy = "block"       // The sender waits until there is room
+	OverflowDropOldest OverflowPolicy = "drop_oldest" // The oldest input on the edge is discarded
+	OverflowFail       OverflowPolicy = "fail"        // The pipeline fails with an overflow error
+)
+
+// queuecfg describes the capacity and overflow policy of the edges into a node.
+type queuecfg struct {
+	Capacity int            `json:"capacity,omitempty"`
+	Overflow OverflowPolicy `json:"overflow,omitempty"`
+}
+
+// merge() answers my values, replaced by any values set in b.
+func (q queuecfg) merge(b queuecfg) queuecfg {
+	if b.Capacity > 0 {
+		q.Capacity = b.Capacity
+	}
+	if b.Overflow != "" {
+		q.Overflow = b.Overflow
+	}
+	return q
+}
+
+func (q queuecfg) validate() error {
+	if q.Capacity < 0 {
+		return NewBadRequestError("Queue capacity can't be negative")
+	}
+	switch q.Overflow {
+	case "", OverflowBlock, OverflowDropOldest, OverflowFail:
+		return nil
+	}
+	return NewBadRequestError("Unknown queue overflow " + string(q.Overflow))
+}
+
+// ----------------------------------------
+// NODE-INBOX
+
+// node_inbox stores the input waiting for a single node. Input arrives on
+// edges, each with its own capacity and overflow policy, and is answered
+// in the order it arrived across all edges. Senders call push() from any
+// goroutine; only the runner calls pop().
+type node_inbox struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	cfg    queuecfg
+	items  list.List // Values are *inbox_item
+	edges  map[string]*inbox_edge
+	closed bool
+}
+
+func newNodeInbox(cfg queuecfg) *node_inbox {
+	b := &node_inbox{cfg: cfg, edges: make(map[string]*inbox_edge)}
+	b.cond = sync.NewCond(&b.mutex)
+	return b
+}
+
+// push() adds the pins on the named edge. When the edge is full and its
+// policy is block, a sender that can block waits for room. A sender inside
+// Process() holds a worker the receiver might need, so it can't block, and
+// passes a waiter instead. The waiter is told when the wait begins and ends,
+// so the worker can be lent out in the meantime; if it answers that waiting
+// could deadlock, the edge exceeds its capacity instead. Answers true if the
+// inbox was empty, which means the runner needs to be told, and the new
+// depth of the edge.
+func (b *node_inbox) push(edge string, pins Pins, block bool, waiter inbox_waiter) (bool, int, error) {
+	defer lock.Locker(&b.mutex).Unlock()
+	e := b.edge(edge)
+	waiting := false
+	defer func() {
+		if waiting {
+			waiter.end()
+		}
+	}()
+	for !b.closed && b.cfg.Capacity > 0 && e.depth >= b.cfg.Capacity {
+		if b.cfg.Overflow == OverflowDropOldest {
+			b.removeOldest(e)
+		} else if b.cfg.Overflow == OverflowFail {
+			return false, e.depth, NewOverflowError("Edge " + edge)
+		} else if block || waiting {
+			b.cond.Wait()
+		} else if waiter != nil && waiter.begin() {
+			waiting = true
+			b.cond.Wait()
+		} else {
+			break
+		}
+	}
+	if b.closed {
+		return false, e.depth, closedErr
+	}
+	wasEmpty := b.items.Len() < 1
+	b.items.PushBack(&inbox_item{e, pins})
+	e.depth++
+	return wasEmpty, e.depth, nil
+}
+
+// pop() answers the oldest input, or false if there is none.
+func (b *node_inbox) pop() (Pins, bool) {
+	defer lock.Locker(&b.mutex).Unlock()
+	front := b.items.Front()
+	if front == nil {
+		return nil, false
+	}
+	b.items.Remove(front)
+	item := front.Value.(*inbox_item)
+	item.edge.depth--
+	b.cond.Broadcast()
+	return item.pins, true
+}
+
+// pending() answers all the input, oldest first.
+func (b *node_inbox) pending() []Pins {
+	defer lock.Locker(&b.mutex).Unlock()
+	var ans []Pins
+	for i := b.items.Front(); i != nil; i = i.Next() {
+		ans = append(ans, i.Value.(*inbox_item).pins)
+	}
+	return ans
+}
+
+func (b *node_inbox) len() int {
+	defer lock.Locker(&b.mutex).Unlock()
+	return b.items.Len()
+}
+
+// depth() answers the current depth of the named edge.
+func (b *node_inbox) depth(edge string) int {
+	defer lock.Locker(&b.mutex).Unlock()
+	if e, ok := b.edges[edge]; ok {
+		return e.depth
+	}
+	return 0
+}
+
+// close() discards all input and releases any blocked senders.
+func (b *node_inbox) close() {
+	defer lock.Locker(&b.mutex).Unlock()
+	b.closed = true
+	b.items.Init()
+	for _, e := range b.edges {
+		e.depth = 0
+	}
+	b.cond.Broadcast()
+}
+
+func (b *node_inbox) edge(name string) *inbox_edge {
+	e, ok := b.edges[name]
+	if !ok {
+		e = &inbox_edge{}
+		b.edges[name] = e
+	}
+	return e
+}
+
+func (b *node_inbox) removeOldest(e *inbox_edge) {
+	for i := b.items.Front(); i != nil; i = i.Next() {
+		if i.Value.(*inbox_item).edge == e {
+			b.items.Remove(i)
+			e.depth--
+			return
+		}
+	}
+}
+
+// ----------------------------------------
+// INBOX-WAITER
+
+// inbox_waiter is told when a sender that can't block waits on a full
+// edge. begin() answers false if the sender can't wait after all.
+type inbox_waiter interface {
+	begin() bool
+	end()
+}
+
+// ----------------------------------------
+// INBOX-EDGE
+
+// inbox_edge tracks the input waiting on a single edge.
+type inbox_edge struct {
+	depth int
+}
+
+// inbox_item is a single input waiting in an inbox.
+type inbox_item struct {
+	edge *inbox_edge
+	pins Pins
+}
+
+// ----------------------------------------
+// MISC
+
+// edgeName() answers the name of the edge from the source node and
+// pin to the destination pin, for the destination node's inbox.
+func edgeName(srcnode, srcpin, dstpin string) string {
+	return srcnode + ":" + srcpin + "->" + dstpin
+}
+
+// ----------------------------------------
+// CONST and VAR
+
+const (
+	default_queue_capacity = 128
+	default_queue_overflow = OverflowBlock
+)
@@ -1,576 +1,1268 @@
-package phly
-
-import (
-	"errors"
-	"fmt"
-	"github.com/micro-go/lock"
-	"reflect"
-	"sync"
-	"unsafe"
-)
-
-var (
-	pid_counter = lock.NewAtomicInt32()
-)
-
-// ----------------------------------------
-// PIPELINE-RUNNER
-
-// pipeline_runner struct is the state of a currently running pipeline.
-type pipeline_runner struct {
-	sargs       StartArgs
-	pargs       ProcessArgs
-	done        chan struct{}
-	p           *pipeline
-	wait        *sync.WaitGroup
-	msgchan     chan *pipeline_msg
-	passthrough chan *pipeline_msg // Message channel that acts as a buffer, preventing cases where a node would send a message on the main thread and block.
-	err         lock.AtomicError   // Store the current state of the running operation, or its result.
-	pid         int32
-}
-
-func startPipelineRunner(p *pipeline, sargs StartArgs, pargs ProcessArgs, input Pins) (*pipeline_runner, error) {
-	done := make(chan struct{})
-	msgchan := make(chan *pipeline_msg, 128)
-	passthrough := make(chan *pipeline_msg, 128)
-	runner := &pipeline_runner{sargs: sargs, pargs: pargs, done: done, p: p, wait: &sync.WaitGroup{}, msgchan: msgchan, passthrough: passthrough, err: lock.NewAtomicError()}
-	runner.pid = pid_counter.Add(1)
-	starting, err := runner.getInitialInputs(input)
-	if err != nil {
-		return nil, err
-	}
-	if starting.empty() {
-		return nil, NewIllegalError("No initial nodes")
-	}
-
-	runner.err.SetTo(pipeline_starting)
-	runner.wait.Add(1)
-	go runner.runPassthrough()
-	go runner.run(pargs, starting)
-	return runner, nil
-}
-
-// close() closes the runner, answering the error returned.
-func (r *pipeline_runner) close() error {
-	if r.done != nil {
-		close(r.done)
-		r.done = nil
-	}
-	if r.wait != nil {
-		r.wait.Wait()
-		r.wait = nil
-	}
-	// Close message channels after we've waited for all routines to stop,
-	if r.passthrough != nil {
-		close(r.passthrough)
-		r.passthrough = nil
-	}
-	if r.msgchan != nil {
-		close(r.msgchan)
-		r.msgchan = nil
-	}
-	return r.err.Get()
-}
-
-func (r *pipeline_runner) runPassthrough() {
-	for {
-		select {
-		case <-r.done:
-			return
-		case msg, more := <-r.passthrough:
-			if more {
-				r.msgchan <- msg
-			}
-		}
-	}
-}
-
-func (r *pipeline_runner) run(args ProcessArgs, starting *nodeInputs) {
-	defer fmt.Println("***RUN DONE")
-	fmt.Println("***+++++++++++++RUN STARTED pid", r.pid)
-	var err error
-
-	defer r.runFinished()
-	defer r.wait.Done()
-	defer func() { r.err.SetTo(err) }()
-
-	state := newPipelineRunningState(r.p, args, r.passthrough)
-	defer state.stopAll()
-	/*
-		err = state.start(starting)
-		fmt.Println("start err", err)
-		if err != nil {
-			return
-		}
-	*/
-
-	fmt.Println("p.run() for")
-	// Treat the initial inputs like any input comimg into
-	// the system and queue them up
-	for name, ins := range starting.nodes {
-		r.passthrough <- newPipelineMsg(Msg{What: WhatPins, Payload: ins}, name)
-	}
-
-	r.err.SetTo(pipeline_running)
-	for {
-		select {
-		case <-r.done:
-			return
-		case msg, more := <-r.msgchan:
-			if more {
-				//				fmt.Println("MSG!", msg, "for", int64(r))
-				fmt.Println("MSG!", msg, "for", r.pid)
-				err, more = r.runMsg(state, msg)
-				if err != nil || !more {
-					fmt.Println("end run from err", err, "more", more)
-					return
-				}
-			}
-		}
-	}
-}
-
-// runFinished() notifies the parent that the runner is ending.
-func (r *pipeline_runner) runFinished() {
-	fmt.Println("run finished")
-	if r.sargs.output != nil {
-		output := r.sargs.output.(*pipelineNodeOutput)
-		fmt.Println("SEND TO OUTPUT", *((*int32)(unsafe.Pointer(output))))
-		r.sargs.output.SendMsg(MsgFromStop(nil))
-		r.sargs.output.SendMsg(Msg{What: whatFlush, Payload: nil})
-	}
-}
-
-func (r *pipeline_runner) runMsg(state *pipeline_running_state, msg *pipeline_msg) (error, bool) {
-	// Deal with any nodes that set the stop after it could be handled but
-	// before the pins were received.
-	state.removeStopped()
-
-	var err error
-	switch msg.What {
-	case WhatPins:
-		// Nil pins are valid, in the case of source nodes running at startup
-		var p Pins
-		if msg.Payload != nil {
-			_p, ok := msg.Payload.(Pins)
-			if !ok {
-				// XXX Warning? Error?
-				return nil, true
-			}
-			p = _p
-		}
-		err = r.runPins(state, msg.Node, p)
-		/*
-			case whatFlush:
-				// A flush happens when I have nothing left to process -- I send a message
-				// down the channel to make sure no one is in flight that will start new nodes.
-				//		fmt.Println("HANDLE FLUSH")
-				if state.empty() {
-					fmt.Println("flush state is empty")
-					return nil, false
-				}
-		*/
-	}
-
-	// If no messages are in flight but no one is processing, I'm stuck, and need to quit.
-	if msg.id == msg_id.Get() && state.waiting() {
-		fmt.Println("ON FINAL MSG", msg_id.Get(), "AND DONE")
-		// XXX This is probably an error? I need to get a sense of the success conditions to know.
-		return nil, false
-	}
-	return err, true
-}
-
-func (r *pipeline_runner) runPins(state *pipeline_running_state, nodename string, _pins Pins) error {
-	fmt.Println("HANDLE PINS!", nodename, _pins)
-
-	var err error
-
-	// Look up the node, creating if necessary, then feeding in the pins.
-	err = state.process(nodename, _pins)
-
-	// Check if we need to stop
-	state.removeStopped()
-	if state.empty() {
-		fmt.Println("send flush")
-		r.passthrough <- newPipelineMsg(Msg{What: whatFlush, Payload: nil}, "")
-	}
-	return err
-}
-
-// ----------------------------------------
-// PIPELINE-RUNNER INITIALIZE
-
-// getInitialInputs() gets all nodes and corresponding inputs that should
-// be performed at the initial processing. Note that a node doesn't need
-// input to be included: It might be a source node with no inputs.
-func (p *pipeline_runner) getInitialInputs(input Pins) (*nodeInputs, error) {
-	ins := nodeInputs{}
-	fmt.Println("Get initial on SIZE", len(p.p.nodes))
-	// 1. All nodes with no input
-	err := p.getSourceInputs(&ins)
-
-	// 2. All nodes with input connected to the pipeline
-	//	sn := p.getNodesForInput(input)
-
-	// 3. All nodes with input from the args or containing pipeline.
-	err = MergeErrors(err, p.getSpecialnputs(input, &ins))
-
-	return &ins, err
-}
-
-// getSourceNodes() answers all nodes with no input.
-func (p *pipeline_runner) getSourceInputs(ins *nodeInputs) error {
-	if len(p.p.nodes) < 1 {
-		return nil
-	}
-	for n, c := range p.p.nodes {
-		if len(c.inputs) < 1 {
-			ins.add(n, "", nil)
-		}
-	}
-	return nil
-}
-
-// getSpecialnputs() answers all nodes with argument or pipeline input.
-// input is the input received by my calling pipeline.
-func (p *pipeline_runner) getSpecialnputs(input Pins, ins *nodeInputs) error {
-	if len(p.p.nodes) < 1 {
-		return nil
-	}
-
-	for _, dstn := range p.p.nodes {
-		for _, conn := range dstn.inputs {
-			if conn.dstNode.name == args_container.name {
-				doc := p.p.args.valueDoc(p.pargs, conn.dstPin)
-				if doc != nil {
-					ins.add(dstn.name, conn.srcPin, NewDocs(doc))
-				}
-			} else if conn.dstNode.name == pipeline_container.name && input != nil {
-				// Mape the pipeline input to this node's input.
-				docs := input.GetPin(conn.dstPin)
-				if len(docs.Docs) > 0 {
-					ins.add(dstn.name, conn.srcPin, &docs)
-				}
-			}
-		}
-	}
-	return nil
-}
-
-// getNodesForInput() answers all nodes targeted by the pins.
-func (p *pipeline_runner) getNodesForInput(input Pins, starting *nodeInputs) {
-	// For each input in the pins, find the destination node and add it to the incoming stack.
-	if input == nil {
-		return
-	}
-	//		for _, descr := range p.inputDescr {
-	//			docs := src.Remove(descr.Name)
-	//			if docs != nil {
-	//				for _, conn := range descr.connections {
-	//					ri.add(conn.DstNode, conn.DstPin, docs)
-	//				}
-	//			}
-	//		}
-}
-
-// ----------------------------------------
-// PIPELINE-RUNNING-STATE
-
-// pipeline_running_state struct stores the state of the running performer thread.
-type pipeline_running_state struct {
-	p       *pipeline
-	args    ProcessArgs
-	nodes   map[string]*pipeline_running_node
-	msgchan chan *pipeline_msg
-}
-
-func newPipelineRunningState(p *pipeline, args ProcessArgs, msgchan chan *pipeline_msg) *pipeline_running_state {
-	nodes := make(map[string]*pipeline_running_node)
-	return &pipeline_running_state{p, args, nodes, msgchan}
-}
-
-func (p *pipeline_running_state) empty() bool {
-	return len(p.nodes) < 1
-}
-
-// waiting() returns true if I can't currently process anything.
-func (p *pipeline_running_state) waiting() bool {
-	fmt.Println("waiting len", len(p.nodes))
-	for _, v := range p.nodes {
-		fmt.Println("\tstage is", v.stage)
-		if v.stage != NodeStarting {
-			return false
-		}
-	}
-	return true
-}
-
-func (p *pipeline_running_state) stopAll() {
-	for k, v := range p.nodes {
-		v.node.StopNode(StoppedArgs{})
-		delete(p.nodes, k)
-	}
-}
-
-func (p *pipeline_running_state) removeStopped() {
-	for k, v := range p.nodes {
-		if v.output.stopped.IsTrue() {
-			v.node.StopNode(StoppedArgs{})
-			delete(p.nodes, k)
-		}
-	}
-}
-
-// handlePins() starts each node in the collection (if not currently running) and
-// supplies the pins.
-// nodename is the node that should process the pins.
-func (p *pipeline_running_state) process(nodename string, pins Pins) error {
-	fmt.Println("handle pins for", nodename)
-	// Find node
-	n := p.nodes[nodename]
-
-	// Create if missing
-	if n == nil {
-		container := p.p.nodes[nodename]
-		if container == nil {
-			return NewMissingError("Node " + nodename)
-		}
-		// XXX We're passing in the pipeline for the output resolver, but probably
-		// we should be caching all the state from the pipeline that we use
-		n = newPipelineRunningNode(p.args, container, p.msgchan, p.p)
-		p.nodes[nodename] = n
-	}
-
-	// Feed input
-	return n.process(pins)
-}
-
-// ----------------------------------------
-// PIPELINE-RUNNING-NODE
-
-// pipeline_running_node struct stores an actively running node.
-type pipeline_running_node struct {
-	args     ProcessArgs
-	node     Node
-	output   *pipelineNodeOutput
-	stage    NodeStage
-	starting *node_starting // Determine when a node moves from starting to running
-}
-
-func newPipelineRunningNode(args ProcessArgs, container *container, msgchan chan *pipeline_msg, resolver outputResolver) *pipeline_running_node {
-	fmt.Println("run", container.name, reflect.TypeOf(container.node))
-	output := newPipelineNodeOutput(container.name, msgchan, resolver)
-	n := &pipeline_running_node{args, container.node, output, NodeStarting, &node_starting{}}
-	return n
-}
-
-func (n *pipeline_running_node) process(pins Pins) error {
-	// We are either accumulating all input needed to start, or we are running.
-	if n.stage == NodeStarting {
-		n.starting.accumulate(pins)
-		if n.starting.ready() {
-			n.stage = NodeRunning
-			return n.node.Process(n.args, NodeStarting, &n.starting.pins, n.output)
-		}
-	} else if pins != nil {
-		return n.node.Process(n.args, n.stage, pins, n.output)
-	}
-	return nil
-	// So this is pretty complicated. It needs to do a lot of things:
-
-	// While stage == waiting, accumulate starting input, if any.
-	// When all starting input is accumulated, send it in with starting.
-	// If there are no inputs, and stage = waiting, start the processing.
-	// If stage == running, send in any input. But here, there must be
-	// input. Only if stage is waiting and the node has no inputs can Pins be nil.
-
-	// So... how to capture all that?
-
-	// A lot of it comes down to a "waiting" state, I guess. As soon as we've
-	// moved to running, we're a simple passthrough. And then a lot of the
-	// complexity comes down to this accumulation behaviour.
-
-	// So... an object that does the accumulation, reporting when it's safe to
-	// call starting based on the state of the pins? Sounds fair
-
-}
-
-// ----------------------------------------
-// NODE-INPUTS
-
-// nodeInputs stores a map of nodes to their input pin data.
-// It is structurally the same as nodeOutputs, but semantically
-// (and behaviourly) different.
-// XXX Actually it looks like it's identical...
-type nodeInputs struct {
-	nodes map[string]*pins
-}
-
-func (s nodeInputs) empty() bool {
-	if s.nodes == nil || len(s.nodes) < 1 {
-		return true
-	}
-	return false
-}
-
-func (s *nodeInputs) add(node, pin string, docs *Docs) {
-	if s.nodes == nil {
-		s.nodes = make(map[string]*pins)
-	}
-	in, ok := s.nodes[node]
-	if !ok {
-		in = &pins{}
-		s.nodes[node] = in
-	}
-	// XXX We should be smart about copying when necessary
-	in.addDocs(pin, docs)
-}
-
-// ----------------------------------------
-// NODE-OUTPUTS
-
-// nodeOutputs stores a map of nodes to their output pin data.
-// It is structurally the same as nodeInputs, but semantically
-// (and behaviourly) different.
-// XXX Actually it looks like it's identical...
-type nodeOutputs struct {
-	nodes map[string]*pins
-}
-
-func (s nodeOutputs) empty() bool {
-	if s.nodes == nil || len(s.nodes) < 1 {
-		return true
-	}
-	return false
-}
-
-func (s *nodeOutputs) add(node, pin string, docs *Docs) {
-	if s.nodes == nil {
-		s.nodes = make(map[string]*pins)
-	}
-	in, ok := s.nodes[node]
-	if !ok {
-		in = &pins{}
-		s.nodes[node] = in
-	}
-	// XXX We should be smart about copying when necessary
-	in.addDocs(pin, docs)
-}
-
-// ----------------------------------------
-// PIPELINE-NODE-OUTPUT
-
-// pipelineNodeOutput is used to deal with node output happening
-// inside of the pipeline's graph.
-type pipelineNodeOutput struct {
-	name     string
-	stopped  lock.AtomicBool
-	msgchan  chan<- *pipeline_msg
-	resolver outputResolver
-}
-
-func newPipelineNodeOutput(name string, msgchan chan<- *pipeline_msg, resolver outputResolver) *pipelineNodeOutput {
-	return &pipelineNodeOutput{name, lock.NewAtomicBool(), msgchan, resolver}
-}
-
-func (p *pipelineNodeOutput) SendPins(pins Pins) {
-	p.SendMsg(MsgFromPins(pins))
-}
-
-func (p *pipelineNodeOutput) SendMsg(msg Msg) {
-	if msg.What == WhatPins {
-		p.handlePinOutputs(msg)
-	} else if msg.What == WhatStop {
-		// Stop is handled differently -- the framework immediately pulls
-		// the node from the processing graph. This allows the possibility for
-		// one-shot nodes to be immediately restarted in a loopback.
-		p.stopped.SetTo(true)
-	} else {
-		p.msgchan <- newPipelineMsg(msg, p.name)
-	}
-}
-
-// handlePinOutputs() converts the outputs into node inputs and feeds them into
-// the system.
-func (p *pipelineNodeOutput) handlePinOutputs(msg Msg) {
-	fmt.Println("handlePinOutputs for", p.name)
-	if msg.What != WhatPins {
-		return
-	}
-	pins, ok := msg.Payload.(Pins)
-	if !ok || pins == nil {
-		return
-	}
-	fmt.Println("handlePinOutputs - walk")
-	pins.WalkPins(func(name string, docs Docs) {
-		// I need destination node and pin names
-		dstnode, dstpin, err := p.resolver.ResolveOutput(p.name, name)
-		fmt.Println("\thandlePinOutputs - dst", dstnode, dstpin, err)
-		outpins, err := BuildPins(dstpin, &docs)
-		if outpins == nil || err != nil {
-			return
-		}
-		fmt.Println("\thandlePinOutputs 2 - dst", dstnode, dstpin, err)
-		p.msgchan <- newPipelineMsg(MsgFromPins(outpins), dstnode)
-	})
-}
-
-// ----------------------------------------
-// NODE-STARTING
-
-// node_starting contains state and behaviour to determine when a newly-added
-// node can receive the NodeStarting stage and input pins.
-type node_starting struct {
-	pins pins
-}
-
-func (n *node_starting) accumulate(pins Pins) {
-	if pins != nil {
-		pins.WalkPins(func(name string, docs Docs) {
-			n.pins.addDocs(name, &docs)
-		})
-	}
-}
-
-// ready() answers true if my data matches the conditions required
-// by the underlying node to start.
-func (n *node_starting) ready() bool {
-	return true
-}
-
-// ----------------------------------------
-// PIPELINE-MSG
-
-type pipeline_msg struct {
-	id int32
-	Msg
-	Node string
-}
-
-func newPipelineMsg(m Msg, n string) *pipeline_msg {
-	return &pipeline_msg{msg_id.Add(1), m, n}
-}
-
-// ----------------------------------------
-// OUTPUT-RESOLVER
-
-// outputResolver is used to convert a source node and output pin name
-// to a destination node and input pin name
-type outputResolver interface {
-	ResolveOutput(srcnode, srcpin string) (string, string, error)
-}
-
-// ----------------------------------------
-// CONST and VAR
-
-var (
-	pipeline_starting = errors.New("ps")
-	pipeline_running  = errors.New("pr")
-
-	msg_id = lock.NewAtomicInt32()
-)
-
-func pipelineRunFakeFmt() {
-	fmt.Println()
-}
+package phly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/micro-go/lock"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------
+// PIPELINE-RUNNER
+
+// pipeline_runner struct is the state of a currently running pipeline.
+type pipeline_runner struct {
+	sargs       StartArgs
+	pargs       ProcessArgs
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        chan struct{}
+	p           *pipeline
+	wait        *sync.WaitGroup
+	msgchan     chan *pipeline_msg
+	finished    chan struct{}    // Closed when the run loop ends, so senders never block on it
+	router      *pipeline_router // Delivers node output to the inboxes
+	stats       *run_stats
+	err         lock.AtomicError // Store the current state of the running operation, or its result.
+	pid         int32
+	tracer      run_tracer
+	outputMutex sync.Mutex
+	output      pins // Everything sent to the pipeline's outs.
+	inputMutex  sync.Mutex
+	inputClosed bool          // Set once the run is done, so input from my parent has to start a new one
+	parentDone  chan struct{} // Closed once my parent has been told the run finished
+}
+
+func startPipelineRunner(ctx context.Context, p *pipeline, sargs StartArgs, pargs ProcessArgs, input Pins) (*pipeline_runner, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var cancel context.CancelFunc
+	if p.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	pargs.ctx = ctx
+	pargs.plan = newRunPlan()
+	pargs.argVars = p.args.vars(pargs)
+
+	done := make(chan struct{})
+	msgchan := make(chan *pipeline_msg, 128)
+	finished := make(chan struct{})
+	runner := &pipeline_runner{sargs: sargs, pargs: pargs, ctx: ctx, cancel: cancel, done: done, p: p, wait: &sync.WaitGroup{}, msgchan: msgchan, finished: finished, err: lock.NewAtomicError(), parentDone: make(chan struct{})}
+	runner.pid = p.getEngine().pids.Add(1)
+	// A nested pipeline shares the observer queue of the pipeline running it,
+	// which delivers everything in order and finishes with its own run.
+	nested := sargs.output != nil
+	observer := sargs.observer
+	if !nested {
+		observer = newObserverQueue(sargs.Observer)
+	}
+	runner.pargs.observer = observer
+	runner.tracer = run_tracer{runner.pid, tracerOrDefault(sargs.Tracer), observer, nested}
+	runner.stats = newRunStats()
+	runner.router = newPipelineRouter(p, msgchan, finished, runner.tracer, runner.stats)
+	starting, err := runner.getInitialInputs(input)
+	if err == nil && sargs.Resume != nil {
+		err = sargs.Resume.validate(p)
+		starting.resume(sargs.Resume)
+	}
+	if err == nil && starting.empty() && (sargs.Resume == nil || len(sargs.Resume.Pending) < 1) {
+		err = NewIllegalError("No initial nodes")
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	runner.err.SetTo(pipeline_starting)
+	runner.wait.Add(1)
+	if !nested {
+		runner.tracer.observer.start()
+	}
+	go runner.run(done, runner.pargs, starting)
+	return runner, nil
+}
+
+// close() closes the runner, answering the error returned.
+func (r *pipeline_runner) close() error {
+	// Close done before cancelling, so the run loop knows the
+	// cancel was requested and not a failure.
+	if r.done != nil {
+		close(r.done)
+		r.done = nil
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+	if r.wait != nil {
+		r.wait.Wait()
+		r.wait = nil
+	}
+	// The message channel is left open: Nodes can outlive the runner,
+	// and they stop sending once the finished channel is closed.
+	return r.err.Get()
+}
+
+func (r *pipeline_runner) run(done <-chan struct{}, args ProcessArgs, starting *nodeInputs) {
+	var err error
+
+	defer r.runFinished()
+	defer r.closeInput(nil)
+	defer r.wait.Done()
+	defer func() { r.err.SetTo(err) }()
+	defer func() { r.tracer.trace(TraceEvent{What: TracePipelineFinished, Err: err}) }()
+	defer r.stats.finished()
+
+	state := newPipelineRunningState(r.p, args, r.router)
+	defer state.stopAll()
+	pool := newWorkerPool(r.p.workerCount())
+	defer pool.close()
+	// However the run ends, cancel the context and release any senders
+	// before waiting on the workers and stopping the nodes.
+	defer r.shutdown()
+
+	// Treat the initial inputs like any input comimg into
+	// the system and queue them up
+	for name, ins := range starting.nodes {
+		err = state.enqueue(name, ins)
+		if err != nil {
+			return
+		}
+	}
+	if c := r.sargs.Resume; c != nil {
+		err = r.resume(state, c)
+		if err != nil {
+			return
+		}
+	}
+	r.schedule(state, pool)
+
+	r.err.SetTo(pipeline_running)
+	for {
+		select {
+		case <-done:
+			return
+		case <-r.ctx.Done():
+			// A requested stop also cancels the context, but isn't an error.
+			select {
+			case <-done:
+			default:
+				err = r.ctx.Err()
+			}
+			return
+		case msg, more := <-r.msgchan:
+			if more {
+				err = r.runMsg(state, pool, msg)
+				r.router.inflight.Add(-1)
+			}
+		case job := <-pool.finished:
+			pool.finish(job)
+			err = r.runJobFinished(state, job)
+		}
+		if err != nil {
+			return
+		}
+		r.answerCheckpoints(state)
+		r.schedule(state, pool)
+		if r.runDone(state) && r.closeInput(state) {
+			return
+		}
+	}
+}
+
+// resume() restores the state saved in the checkpoint.
+func (r *pipeline_runner) resume(state *pipeline_running_state, c *Checkpoint) error {
+	r.addOutput(c.Output)
+	for _, name := range c.Stopped {
+		state.stopped[name] = struct{}{}
+	}
+	for name, all := range c.Pending {
+		for _, pins := range all {
+			err := state.enqueue(name, pins)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// answerCheckpoints() answers any requested checkpoints, once no node is busy.
+func (r *pipeline_runner) answerCheckpoints(state *pipeline_running_state) {
+	if len(state.checkpoints) < 1 || state.busy() {
+		return
+	}
+	c := newCheckpoint(r, state)
+	for _, reply := range state.checkpoints {
+		reply <- c
+	}
+	state.checkpoints = nil
+}
+
+// shutdown() cancels the context and releases anything sending to the
+// runner, since it won't receive anything else.
+func (r *pipeline_runner) shutdown() {
+	r.cancel()
+	close(r.finished)
+	for _, inbox := range r.router.inboxes {
+		inbox.close()
+	}
+}
+
+// runFinished() notifies the parent that the runner is ending. Any
+// error is handed to the parent's error handling for the node running me.
+func (r *pipeline_runner) runFinished() {
+	defer close(r.parentDone)
+	if r.sargs.output != nil {
+		r.sargs.output.SendMsg(MsgFromStop(r.err.Get()))
+	}
+}
+
+// closeInput() stops input from my parent, answering false if input
+// arrived after the state was done, so the run has to continue. A nil
+// state closes the input no matter what.
+func (r *pipeline_runner) closeInput(state *pipeline_running_state) bool {
+	defer lock.Locker(&r.inputMutex).Unlock()
+	if state != nil && !r.runDone(state) {
+		return false
+	}
+	r.inputClosed = true
+	return true
+}
+
+// input() routes input from my parent through my ins, answering false
+// if the run is done and can't take it.
+func (r *pipeline_runner) input(input Pins) bool {
+	defer lock.Locker(&r.inputMutex).Unlock()
+	if r.inputClosed {
+		return false
+	}
+	ans := true
+	r.p.routeInput(input, func(name string, dst connectionDescr, docs *Docs) {
+		inbox := r.router.inboxes[dst.DstNode]
+		pins, err := BuildPins(dst.DstPin, docs)
+		if inbox == nil || pins == nil || err != nil {
+			return
+		}
+		notify, depth, err := inbox.push(edgeName(ins_node, name, dst.DstPin), pins, true, nil)
+		if err == closedErr {
+			ans = false
+			return
+		} else if err != nil {
+			r.router.send(newPipelineMsg(Msg{What: whatError, Payload: err}, ins_node))
+			return
+		}
+		r.tracer.trace(TraceEvent{What: TracePinsRouted, Node: ins_node, Pin: name, DstNode: dst.DstNode, DstPin: dst.DstPin, Docs: len(docs.Docs), Depth: depth})
+		if notify {
+			r.router.send(newPipelineMsg(Msg{What: whatInput}, dst.DstNode))
+		}
+	})
+	return ans
+}
+
+// nodeFailed() applies the node's error policy to an error it reported
+// when it stopped, outside of Process(), such as a nested pipeline that
+// failed. The node has already stopped, so there's nothing to retry.
+func (r *pipeline_runner) nodeFailed(state *pipeline_running_state, name string, err error) error {
+	r.tracer.trace(TraceEvent{What: TraceError, Node: name, Err: err})
+	c := r.p.nodes[name]
+	if c == nil || c.onError.fails() {
+		return err
+	}
+	if c.onError.Policy != ErrorRoute {
+		return nil
+	}
+	dsts, rerr := r.router.resolver.ResolveOutput(name, c.onError.Pin)
+	if rerr != nil {
+		return nil
+	}
+	for _, dst := range dsts {
+		pins := PinBuilder{}.Add(dst.DstPin, newErrorDoc(name, err)).Pins()
+		if dst.DstNode == pipeline_container.name {
+			rerr = r.runPins(state, dst.DstNode, pins)
+		} else {
+			rerr = state.enqueue(dst.DstNode, pins)
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+	return nil
+}
+
+func (r *pipeline_runner) runMsg(state *pipeline_running_state, pool *worker_pool, msg *pipeline_msg) error {
+	// Deal with any nodes that set the stop after it could be handled but
+	// before the pins were received.
+	state.removeStopped()
+
+	var err error
+	switch msg.What {
+	case WhatPins:
+		// Nil pins are valid, in the case of source nodes running at startup
+		var p Pins
+		if msg.Payload != nil {
+			_p, ok := msg.Payload.(Pins)
+			if !ok {
+				// XXX Warning? Error?
+				return nil
+			}
+			p = _p
+		}
+		err = r.runPins(state, msg.Node, p)
+	case whatInput:
+		// A node's inbox has received input
+		state.markReady(msg.Node)
+	case whatError:
+		if e, ok := msg.Payload.(error); ok && e != nil {
+			r.tracer.trace(TraceEvent{What: TraceError, Node: msg.Node, Err: e})
+			err = e
+		}
+	case whatStopped:
+		// Stopped nodes were removed above. The message wakes me
+		// for nodes that stop outside of Process().
+		if e, ok := msg.Payload.(error); ok && e != nil {
+			err = r.nodeFailed(state, msg.Node, e)
+		}
+	case whatWaiting:
+		pool.lend()
+	case whatWaited:
+		pool.reclaim()
+	case whatCheckpoint:
+		if reply, ok := msg.Payload.(chan *Checkpoint); ok {
+			state.checkpoints = append(state.checkpoints, reply)
+		}
+	case whatPause, whatResume:
+		paused := msg.What == whatPause
+		if paused != state.paused {
+			state.paused = paused
+			what := TracePipelineResumed
+			if paused {
+				what = TracePipelinePaused
+			}
+			r.tracer.trace(TraceEvent{What: what})
+		}
+	}
+	return err
+}
+
+func (r *pipeline_runner) runPins(state *pipeline_running_state, nodename string, _pins Pins) error {
+	// Pins sent to the pipeline are sent on by the node running me,
+	// or collected as my output.
+	if nodename == pipeline_container.name {
+		if r.sargs.output != nil {
+			r.sargs.output.SendPins(_pins)
+			return nil
+		}
+		r.addOutput(_pins)
+		return nil
+	}
+
+	// Queue the pins for the node; they'll be processed when a worker is free.
+	return state.enqueue(nodename, _pins)
+}
+
+// runJobFinished() handles a node that a worker has finished processing.
+// An error only ends the run if the node's error policy says so, otherwise
+// the node is stopped, and a new one handles its next input, starting with
+// the startup input the failed one received.
+func (r *pipeline_runner) runJobFinished(state *pipeline_running_state, job *pipeline_job) error {
+	state.finishJob(job)
+	if job.err != nil {
+		if job.node.onError.fails() {
+			return job.err
+		}
+		if job.node.stage == NodeRunning {
+			state.restarts[job.name] = job.node.starting.startupPins()
+		}
+		job.node.output.stopped.SetTo(true)
+	}
+	state.removeStopped()
+	return nil
+}
+
+// schedule() hands pending input to idle workers. While paused, only
+// the signals telling nodes about the pause are handed out, and nothing
+// is handed out while waiting to take a checkpoint, unless a node is
+// waiting on a full edge, since the checkpoint waits on that node.
+func (r *pipeline_runner) schedule(state *pipeline_running_state, pool *worker_pool) {
+	for pool.idle > 0 && (len(state.checkpoints) < 1 || pool.lent > 0) {
+		job := state.nextSignal()
+		if job == nil && !state.paused {
+			job = state.nextJob()
+		}
+		if job == nil {
+			return
+		}
+		pool.start(job)
+	}
+}
+
+// runDone() answers true when the pipeline is done: No messages are in
+// flight to me, and my state is idle. Everything is tracked per runner,
+// so other pipelines running in the process have no effect.
+func (r *pipeline_runner) runDone(state *pipeline_running_state) bool {
+	return r.router.inflight.Get() == 0 && state.idle()
+}
+
+func (r *pipeline_runner) addOutput(_pins Pins) {
+	if _pins == nil {
+		return
+	}
+	defer lock.Locker(&r.outputMutex).Unlock()
+	_pins.WalkPins(func(name string, docs Docs) {
+		r.output.addDocs(name, &docs)
+	})
+}
+
+// getOutput() answers a copy of everything sent to the pipeline's outs.
+func (r *pipeline_runner) getOutput() Pins {
+	ans := &pins{}
+	if r == nil {
+		return ans
+	}
+	defer lock.Locker(&r.outputMutex).Unlock()
+	r.output.WalkPins(func(name string, docs Docs) {
+		ans.addDocs(name, &docs)
+	})
+	return ans
+}
+
+// ----------------------------------------
+// PIPELINE-RUNNER INITIALIZE
+
+// getInitialInputs() gets all nodes and corresponding inputs that should
+// be performed at the initial processing. Note that a node doesn't need
+// input to be included: It might be a source node with no inputs.
+func (p *pipeline_runner) getInitialInputs(input Pins) (*nodeInputs, error) {
+	ins := nodeInputs{}
+	// 1. All nodes with no input
+	err := p.getSourceInputs(&ins)
+
+	// 2. All nodes with input connected to the pipeline
+	p.getNodesForInput(input, &ins)
+
+	// 3. All nodes with input from the args or containing pipeline.
+	err = MergeErrors(err, p.getSpecialnputs(input, &ins))
+
+	return &ins, err
+}
+
+// getSourceNodes() answers all nodes with no input.
+func (p *pipeline_runner) getSourceInputs(ins *nodeInputs) error {
+	if len(p.p.nodes) < 1 {
+		return nil
+	}
+	for n, c := range p.p.nodes {
+		if len(c.inputs) < 1 {
+			ins.add(n, "", nil)
+		}
+	}
+	return nil
+}
+
+// getSpecialnputs() answers all nodes with argument or pipeline input.
+// input is the input received by my calling pipeline.
+func (p *pipeline_runner) getSpecialnputs(input Pins, ins *nodeInputs) error {
+	if len(p.p.nodes) < 1 {
+		return nil
+	}
+
+	for _, dstn := range p.p.nodes {
+		for _, conn := range dstn.inputs {
+			if conn.dstNode.name == args_container.name {
+				doc, err := p.p.args.valueDoc(p.pargs, conn.dstPin)
+				if err != nil {
+					return err
+				}
+				if doc != nil {
+					ins.add(dstn.name, conn.srcPin, NewDocs(doc))
+				}
+			} else if conn.dstNode.name == pipeline_container.name && input != nil {
+				// Mape the pipeline input to this node's input.
+				docs := input.GetPin(conn.dstPin)
+				if len(docs.Docs) > 0 {
+					ins.add(dstn.name, conn.srcPin, &docs)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getNodesForInput() adds the input to every node connected to my ins.
+func (p *pipeline_runner) getNodesForInput(input Pins, starting *nodeInputs) {
+	p.p.routeInput(input, func(name string, dst connectionDescr, docs *Docs) {
+		starting.add(dst.DstNode, dst.DstPin, docs)
+	})
+}
+
+// ----------------------------------------
+// PIPELINE-RUNNING-STATE
+
+// pipeline_running_state struct stores the state of the running performer thread.
+type pipeline_running_state struct {
+	p           *pipeline
+	args        ProcessArgs
+	nodes       map[string]*pipeline_running_node
+	router      *pipeline_router
+	tracer      run_tracer
+	ready       []string            // Nodes with input in their inbox and no job in flight
+	queued      map[string]struct{} // The nodes in ready
+	paused      bool                // No input is handed to nodes while paused
+	stopped     map[string]struct{} // Nodes that have stopped at least once
+	restarts    map[string]Pins     // The startup input for nodes replaced after an error
+	checkpoints []chan *Checkpoint  // Requests waiting for no node to be busy
+}
+
+func newPipelineRunningState(p *pipeline, args ProcessArgs, router *pipeline_router) *pipeline_running_state {
+	nodes := make(map[string]*pipeline_running_node)
+	queued := make(map[string]struct{})
+	stopped := make(map[string]struct{})
+	restarts := make(map[string]Pins)
+	return &pipeline_running_state{p: p, args: args, nodes: nodes, router: router, tracer: router.tracer, queued: queued, stopped: stopped, restarts: restarts}
+}
+
+func (p *pipeline_running_state) empty() bool {
+	return len(p.nodes) < 1
+}
+
+// idle() returns true if I can't currently process anything: No input is
+// waiting, no worker is processing, and every node has stopped. A node
+// still accumulating its startup input never started, so it counts as stopped.
+func (p *pipeline_running_state) idle() bool {
+	for _, inbox := range p.router.inboxes {
+		if inbox.len() > 0 {
+			return false
+		}
+	}
+	for _, v := range p.nodes {
+		if v.busy || v.stage != NodeStarting {
+			return false
+		}
+	}
+	return true
+}
+
+// busy() returns true if any node is being processed.
+func (p *pipeline_running_state) busy() bool {
+	for _, v := range p.nodes {
+		if v.busy {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pipeline_running_state) stopAll() {
+	for k, v := range p.nodes {
+		p.stopNode(k, v)
+	}
+}
+
+func (p *pipeline_running_state) removeStopped() {
+	for k, v := range p.nodes {
+		// Nodes are never stopped while a worker is processing them.
+		if v.output.stopped.IsTrue() && !v.busy {
+			p.stopNode(k, v)
+		}
+	}
+}
+
+func (p *pipeline_running_state) stopNode(name string, n *pipeline_running_node) {
+	err := n.stop()
+	delete(p.nodes, name)
+	p.stopped[name] = struct{}{}
+	p.router.stats.stopped(name)
+	if err != nil {
+		p.tracer.trace(TraceEvent{What: TraceError, Node: name, Err: err})
+	}
+	p.tracer.trace(TraceEvent{What: TraceNodeStopped, Node: name})
+}
+
+// enqueue() adds the pins to the node's inbox. This is used for input from
+// the runner itself, so it never blocks.
+// nodename is the node that should process the pins.
+func (p *pipeline_running_state) enqueue(nodename string, pins Pins) error {
+	inbox := p.router.inboxes[nodename]
+	if inbox == nil {
+		return NewMissingError("Node " + nodename)
+	}
+	_, _, err := inbox.push(startup_edge, pins, false, nil)
+	if err != nil {
+		return err
+	}
+	p.markReady(nodename)
+	return nil
+}
+
+// markReady() adds the node to the ready list if it has input and isn't busy.
+func (p *pipeline_running_state) markReady(nodename string) {
+	inbox := p.router.inboxes[nodename]
+	if inbox == nil || inbox.len() < 1 {
+		return
+	}
+	if _, ok := p.queued[nodename]; ok {
+		return
+	}
+	if n := p.nodes[nodename]; n != nil && n.busy {
+		return
+	}
+	p.queued[nodename] = struct{}{}
+	p.ready = append(p.ready, nodename)
+}
+
+// nextJob() answers the oldest input for the next ready node, creating
+// the node if it isn't running. Only one job per node is ever in flight, so
+// every node receives its input in order. Answers nil if nothing is ready.
+func (p *pipeline_running_state) nextJob() *pipeline_job {
+	if len(p.ready) < 1 {
+		return nil
+	}
+	nodename := p.ready[0]
+	p.ready = p.ready[1:]
+	delete(p.queued, nodename)
+	pins, ok := p.router.inboxes[nodename].pop()
+	if !ok {
+		return p.nextJob()
+	}
+
+	// Find node. Any node that stopped since the last check is replaced,
+	// the same as any other input to a stopped node.
+	n := p.nodes[nodename]
+	if n != nil && n.output.stopped.IsTrue() {
+		p.stopNode(nodename, n)
+		n = nil
+	}
+
+	// Create if missing
+	if n == nil {
+		// XXX We're passing in the pipeline for the output resolver, but probably
+		// we should be caching all the state from the pipeline that we use
+		n = newPipelineRunningNode(p.args, p.p.nodes[nodename], p.router)
+		if restart, ok := p.restarts[nodename]; ok {
+			n.starting.accumulate(restart)
+			delete(p.restarts, nodename)
+		}
+		p.nodes[nodename] = n
+		p.tracer.trace(TraceEvent{What: TraceNodeCreated, Node: nodename})
+	}
+
+	n.busy = true
+	return &pipeline_job{name: nodename, node: n, pins: pins}
+}
+
+// nextSignal() answers a job to tell the next pausable node that
+// the pipeline has paused or resumed, or nil if all nodes know.
+func (p *pipeline_running_state) nextSignal() *pipeline_job {
+	for name, n := range p.nodes {
+		if n.pausable && !n.busy && n.stage == NodeRunning && n.paused != p.paused && !n.output.stopped.IsTrue() {
+			n.busy = true
+			n.paused = p.paused
+			stage := NodeResuming
+			if p.paused {
+				stage = NodePausing
+			}
+			return &pipeline_job{name: name, node: n, stage: stage}
+		}
+	}
+	return nil
+}
+
+// finishJob() makes the node available for any remaining input.
+func (p *pipeline_running_state) finishJob(job *pipeline_job) {
+	job.node.busy = false
+	if job.err != nil {
+		p.tracer.trace(TraceEvent{What: TraceError, Node: job.name, Err: job.err})
+	}
+	p.markReady(job.name)
+}
+
+// ----------------------------------------
+// PIPELINE-RUNNING-NODE
+
+// pipeline_running_node struct stores an actively running node.
+type pipeline_running_node struct {
+	args     ProcessArgs
+	node     Node
+	id       string // The node's registered id
+	output   *pipelineNodeOutput
+	stage    NodeStage
+	starting *node_starting // Determine when a node moves from starting to running
+	onError  errorcfg
+	pausable bool // The node receives NodePausing and NodeResuming
+	paused   bool // The last of those stages the node received
+	busy     bool // True while a worker is processing this node. Only the runner reads or writes this.
+}
+
+func newPipelineRunningNode(args ProcessArgs, container *container, router *pipeline_router) *pipeline_running_node {
+	output := newPipelineNodeOutput(container.name, router)
+	args.node = container.name
+	descr := container.node.Describe()
+	starting := newNodeStarting(descr, container)
+	n := &pipeline_running_node{args: args, node: container.node, id: descr.Id, output: output, stage: NodeStarting, starting: starting, onError: container.onError, pausable: descr.Pausable}
+	return n
+}
+
+func (n *pipeline_running_node) process(pins Pins) error {
+	n.output.processing.SetTo(true)
+	defer n.output.processing.SetTo(false)
+	n.output.router.stats.received(n.output.name, pins)
+
+	// We are either accumulating all input needed to start, or we are running.
+	if n.stage == NodeStarting {
+		n.starting.accumulate(pins)
+		if n.starting.ready() {
+			n.stage = NodeRunning
+			n.output.router.tracer.trace(TraceEvent{What: TraceNodeStarted, Node: n.output.name})
+			n.output.router.stats.started(n.output.name)
+			return n.run(NodeStarting, &n.starting.pins)
+		}
+	} else if pins != nil {
+		return n.run(n.stage, pins)
+	}
+	return nil
+	// So this is pretty complicated. It needs to do a lot of things:
+
+	// While stage == waiting, accumulate starting input, if any.
+	// When all starting input is accumulated, send it in with starting.
+	// If there are no inputs, and stage = waiting, start the processing.
+	// If stage == running, send in any input. But here, there must be
+	// input. Only if stage is waiting and the node has no inputs can Pins be nil.
+
+	// So... how to capture all that?
+
+	// A lot of it comes down to a "waiting" state, I guess. As soon as we've
+	// moved to running, we're a simple passthrough. And then a lot of the
+	// complexity comes down to this accumulation behaviour.
+
+	// So... an object that does the accumulation, reporting when it's safe to
+	// call starting based on the state of the pins? Sounds fair
+
+}
+
+// run() calls Process, applying the retry and route error policies. Any
+// error is still answered, so the runner can trace it and apply the rest.
+func (n *pipeline_running_node) run(stage NodeStage, pins Pins) error {
+	err := n.callProcess(stage, pins)
+	for retry := 0; err != nil && retry < n.onError.retries(); retry++ {
+		n.output.router.tracer.trace(TraceEvent{What: TraceNodeRetry, Node: n.output.name, Err: err})
+		select {
+		case <-time.After(n.onError.wait(retry)):
+		case <-n.args.Context().Done():
+			return err
+		}
+		// A node that stopped while failing gets another chance.
+		n.output.stopped.SetTo(false)
+		err = n.callProcess(stage, pins)
+	}
+	if err != nil && n.onError.Policy == ErrorRoute {
+		n.output.SendPins(PinBuilder{}.Add(n.onError.Pin, newErrorDoc(n.output.name, err)).Pins())
+	}
+	return err
+}
+
+// signal() hands a stage with no input, such as NodePausing, to the node.
+func (n *pipeline_running_node) signal(stage NodeStage) error {
+	n.output.processing.SetTo(true)
+	defer n.output.processing.SetTo(false)
+	return n.callProcess(stage, nil)
+}
+
+// callProcess() calls Process, answering any panic as an error.
+func (n *pipeline_running_node) callProcess(stage NodeStage, pins Pins) (err error) {
+	start := time.Now()
+	defer func() { n.output.router.stats.processed(n.output.name, time.Since(start)) }()
+	defer n.recoverPanic(&err)
+	return n.node.Process(n.args, stage, pins, n.output)
+}
+
+// stop() calls StopNode, answering any panic as an error.
+func (n *pipeline_running_node) stop() (err error) {
+	defer n.recoverPanic(&err)
+	return n.node.StopNode(StoppedArgs{})
+}
+
+// recoverPanic() sets err from a panic in the node. It must be deferred.
+func (n *pipeline_running_node) recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = NewPanicError(n.output.name, n.id, r, debug.Stack())
+	}
+}
+
+// ----------------------------------------
+// NODE-INPUTS
+
+// nodeInputs stores a map of nodes to their input pin data.
+// It is structurally the same as nodeOutputs, but semantically
+// (and behaviourly) different.
+// XXX Actually it looks like it's identical...
+type nodeInputs struct {
+	nodes map[string]*pins
+}
+
+func (s nodeInputs) empty() bool {
+	if s.nodes == nil || len(s.nodes) < 1 {
+		return true
+	}
+	return false
+}
+
+// resume() removes the nodes the checkpoint doesn't want started.
+func (s *nodeInputs) resume(c *Checkpoint) {
+	for name := range s.nodes {
+		if c.skips(name) {
+			delete(s.nodes, name)
+		}
+	}
+}
+
+func (s *nodeInputs) add(node, pin string, docs *Docs) {
+	if s.nodes == nil {
+		s.nodes = make(map[string]*pins)
+	}
+	in, ok := s.nodes[node]
+	if !ok {
+		in = &pins{}
+		s.nodes[node] = in
+	}
+	// XXX We should be smart about copying when necessary
+	in.addDocs(pin, docs)
+}
+
+// ----------------------------------------
+// NODE-OUTPUTS
+
+// nodeOutputs stores a map of nodes to their output pin data.
+// It is structurally the same as nodeInputs, but semantically
+// (and behaviourly) different.
+// XXX Actually it looks like it's identical...
+type nodeOutputs struct {
+	nodes map[string]*pins
+}
+
+func (s nodeOutputs) empty() bool {
+	if s.nodes == nil || len(s.nodes) < 1 {
+		return true
+	}
+	return false
+}
+
+func (s *nodeOutputs) add(node, pin string, docs *Docs) {
+	if s.nodes == nil {
+		s.nodes = make(map[string]*pins)
+	}
+	in, ok := s.nodes[node]
+	if !ok {
+		in = &pins{}
+		s.nodes[node] = in
+	}
+	// XXX We should be smart about copying when necessary
+	in.addDocs(pin, docs)
+}
+
+// ----------------------------------------
+// PIPELINE-NODE-OUTPUT
+
+// pipelineNodeOutput is used to deal with node output happening
+// inside of the pipeline's graph.
+type pipelineNodeOutput struct {
+	name       string
+	stopped    lock.AtomicBool
+	processing lock.AtomicBool // True while the node is inside Process()
+	router     *pipeline_router
+}
+
+func newPipelineNodeOutput(name string, router *pipeline_router) *pipelineNodeOutput {
+	return &pipelineNodeOutput{name, lock.NewAtomicBool(), lock.NewAtomicBool(), router}
+}
+
+func (p *pipelineNodeOutput) SendPins(pins Pins) {
+	p.SendMsg(MsgFromPins(pins))
+}
+
+func (p *pipelineNodeOutput) SendMsg(msg Msg) {
+	if msg.What == WhatPins {
+		p.handlePinOutputs(msg)
+	} else if msg.What == WhatStop {
+		// Stop is handled differently -- the framework immediately pulls
+		// the node from the processing graph. This allows one-shot nodes
+		// to be immediately restarted in a loop. See pipeline_loop.go.
+		p.stopped.SetTo(true)
+		// Wake the runner, in case the node stopped outside of Process(),
+		// and hand it any error the node stopped with.
+		var err error
+		if payload, ok := msg.Payload.(*StopPayload); ok && payload != nil {
+			err = payload.Err
+		}
+		p.router.send(newPipelineMsg(Msg{What: whatStopped, Payload: err}, p.name))
+	} else {
+		p.router.send(newPipelineMsg(msg, p.name))
+	}
+}
+
+// handlePinOutputs() converts the outputs into node inputs and feeds them into
+// the system.
+func (p *pipelineNodeOutput) handlePinOutputs(msg Msg) {
+	if msg.What != WhatPins {
+		return
+	}
+	pins, ok := msg.Payload.(Pins)
+	if !ok || pins == nil {
+		return
+	}
+	pins.WalkPins(func(name string, docs Docs) {
+		// I need destination node and pin names
+		p.router.stats.sent(p.name, docs)
+		dsts, err := p.router.resolver.ResolveOutput(p.name, name)
+		if err != nil {
+			return
+		}
+		for i, dst := range dsts {
+			// Every destination gets its own message. All but the last
+			// receive a copy, so no two consumers share the same doc.
+			send := &docs
+			if i < len(dsts)-1 {
+				send = docs.Copy()
+			}
+			if err := p.router.checkMimeTypes(p.name, name, dst, send); err != nil {
+				p.router.send(newPipelineMsg(Msg{What: whatError, Payload: err}, p.name))
+				continue
+			}
+			outpins, err := BuildPins(dst.DstPin, send)
+			if outpins == nil || err != nil {
+				continue
+			}
+			p.route(name, dst, outpins, len(send.Docs))
+		}
+	})
+}
+
+// route() delivers the pins from my srcpin to a single destination.
+func (p *pipelineNodeOutput) route(srcpin string, dst connectionDescr, pins Pins, docs int) {
+	e := TraceEvent{What: TracePinsRouted, Node: p.name, Pin: srcpin, DstNode: dst.DstNode, DstPin: dst.DstPin, Docs: docs}
+	// Output to the pipeline is collected by the runner.
+	if dst.DstNode == pipeline_container.name {
+		p.router.tracer.trace(e)
+		p.router.stats.routed(p.name, srcpin, dst, pins, 0)
+		p.router.send(newPipelineMsg(MsgFromPins(pins), dst.DstNode))
+		return
+	}
+
+	inbox := p.router.inboxes[dst.DstNode]
+	if inbox == nil {
+		return
+	}
+	// Output around a cycle ends once it reaches the limit.
+	key := connection_key{p.name, srcpin, dst.DstNode, dst.DstPin}
+	if !p.router.loops.next(key) {
+		e.What = TraceLoopLimit
+		e.Err = loopLimitErr(key, p.router.loops.limits[key])
+		p.router.tracer.trace(e)
+		return
+	}
+	// A node inside Process() holds a worker that the destination might
+	// need to drain its inbox, so it waits through the router instead.
+	var waiter inbox_waiter
+	block := !p.processing.IsTrue()
+	if !block {
+		waiter = &send_waiter{p.router, p.name, dst.DstNode}
+	}
+	notify, depth, err := inbox.push(edgeName(p.name, srcpin, dst.DstPin), pins, block, waiter)
+	if err == closedErr {
+		return
+	} else if err != nil {
+		p.router.send(newPipelineMsg(Msg{What: whatError, Payload: err}, p.name))
+		return
+	}
+	e.Depth = depth
+	p.router.tracer.trace(e)
+	p.router.stats.routed(p.name, srcpin, dst, pins, depth)
+	if notify {
+		p.router.send(newPipelineMsg(Msg{What: whatInput}, dst.DstNode))
+	}
+}
+
+// ----------------------------------------
+// PIPELINE-ROUTER
+
+// pipeline_router is shared by every node output in a runner,
+// and delivers output to the runner and node inboxes.
+type pipeline_router struct {
+	resolver outputResolver
+	inboxes  map[string]*node_inbox // Created once when the runner starts, so reads are safe
+	msgchan  chan<- *pipeline_msg
+	finished <-chan struct{}
+	inflight lock.AtomicInt32 // Messages sent to the runner that it hasn't handled
+	tracer   run_tracer
+	stats    *run_stats
+	loops    *loop_counter
+	descrs   map[string]NodeDescr // Used to check the MIME types of routed docs
+	// Nodes waiting on a full edge from inside Process(), and the number
+	// of waits on each destination node.
+	waitMutex sync.Mutex
+	waiting   map[string]map[string]int
+}
+
+func newPipelineRouter(p *pipeline, msgchan chan<- *pipeline_msg, finished <-chan struct{}, tracer run_tracer, stats *run_stats) *pipeline_router {
+	inboxes := make(map[string]*node_inbox)
+	descrs := make(map[string]NodeDescr)
+	for name, c := range p.nodes {
+		inboxes[name] = newNodeInbox(p.queueCfg(c))
+		descrs[name] = c.node.Describe()
+	}
+	return &pipeline_router{resolver: p, inboxes: inboxes, msgchan: msgchan, finished: finished, inflight: lock.NewAtomicInt32(), tracer: tracer, stats: stats, loops: newLoopCounter(p.loops), descrs: descrs, waiting: make(map[string]map[string]int)}
+}
+
+// checkMimeTypes() answers an error if any doc sent to the
+// destination has a MIME type its pin doesn't accept.
+func (r *pipeline_router) checkMimeTypes(srcnode, srcpin string, dst connectionDescr, docs *Docs) error {
+	descr := r.descrs[dst.DstNode]
+	pin := descr.FindInput(dst.DstPin)
+	if pin == nil {
+		pin = descr.FindStartup(dst.DstPin)
+	}
+	if pin == nil || docs == nil {
+		return nil
+	}
+	for _, doc := range docs.Docs {
+		if doc != nil && !pin.Accepts(doc.MimeType) {
+			return NewMimeTypeError(srcnode + ":" + srcpin + " sent " + doc.MimeType + " to " + dst.DstNode + ":" + dst.DstPin + ", which accepts " + strings.Join(pin.MimeTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// send() sends the message to the runner, unless the runner has finished.
+// The message counts as in flight until the runner handles it.
+func (r *pipeline_router) send(msg *pipeline_msg) {
+	r.inflight.Add(1)
+	select {
+	case r.msgchan <- msg:
+	case <-r.finished:
+	}
+}
+
+// post() sends the message to the runner without waiting, for senders
+// that hold a lock the runner might need.
+func (r *pipeline_router) post(msg *pipeline_msg) {
+	r.inflight.Add(1)
+	go func() {
+		select {
+		case r.msgchan <- msg:
+		case <-r.finished:
+		}
+	}()
+}
+
+// beginWait() records the src node waiting on the dst node, answering
+// false if the dst node is already waiting on src, directly or around a
+// cycle, since neither could ever continue.
+func (r *pipeline_router) beginWait(src, dst string) bool {
+	defer lock.Locker(&r.waitMutex).Unlock()
+	if r.waitsOn(dst, src, make(map[string]struct{})) {
+		return false
+	}
+	dsts, ok := r.waiting[src]
+	if !ok {
+		dsts = make(map[string]int)
+		r.waiting[src] = dsts
+	}
+	dsts[dst]++
+	r.post(newPipelineMsg(Msg{What: whatWaiting}, src))
+	return true
+}
+
+// endWait() removes a wait recorded by beginWait().
+func (r *pipeline_router) endWait(src, dst string) {
+	defer lock.Locker(&r.waitMutex).Unlock()
+	dsts := r.waiting[src]
+	dsts[dst]--
+	if dsts[dst] < 1 {
+		delete(dsts, dst)
+	}
+	if len(dsts) < 1 {
+		delete(r.waiting, src)
+	}
+	r.post(newPipelineMsg(Msg{What: whatWaited}, src))
+}
+
+// waitsOn() answers true if node a is b, or is waiting on b through any chain of waits.
+func (r *pipeline_router) waitsOn(a, b string, visited map[string]struct{}) bool {
+	if a == b {
+		return true
+	}
+	if _, ok := visited[a]; ok {
+		return false
+	}
+	visited[a] = struct{}{}
+	for dst := range r.waiting[a] {
+		if r.waitsOn(dst, b, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// depth() answers the input waiting on the edge described by the stats.
+func (r *pipeline_router) depth(e EdgeStats) int {
+	inbox := r.inboxes[e.DstNode]
+	if inbox == nil {
+		return 0
+	}
+	return inbox.depth(edgeName(e.SrcNode, e.SrcPin, e.DstPin))
+}
+
+// ----------------------------------------
+// SEND-WAITER
+
+// send_waiter lets a node inside Process() wait on a full edge. Its
+// worker is lent to the runner for the duration, so the destination
+// can still run.
+type send_waiter struct {
+	router *pipeline_router
+	src    string
+	dst    string
+}
+
+func (w *send_waiter) begin() bool {
+	return w.router.beginWait(w.src, w.dst)
+}
+
+func (w *send_waiter) end() {
+	w.router.endWait(w.src, w.dst)
+}
+
+// ----------------------------------------
+// NODE-STARTING
+
+// node_starting contains state and behaviour to determine when a newly-added
+// node can receive the NodeStarting stage and input pins.
+type node_starting struct {
+	pins     pins
+	startup  []string // All startup pins
+	required []string // The startup pins that must have data before the node starts.
+}
+
+// newNodeStarting() answers the starting state for the node. Every required
+// startup pin must receive data, as must every optional startup pin that is
+// connected in the graph.
+func newNodeStarting(descr NodeDescr, c *container) *node_starting {
+	connected := make(map[string]struct{})
+	for _, conn := range c.inputs {
+		connected[conn.srcPin] = struct{}{}
+	}
+	n := &node_starting{}
+	for _, pin := range descr.StartupPins {
+		n.startup = append(n.startup, pin.Name)
+		if _, ok := connected[pin.Name]; ok || !pin.Optional {
+			n.required = append(n.required, pin.Name)
+		}
+	}
+	return n
+}
+
+func (n *node_starting) accumulate(pins Pins) {
+	if pins != nil {
+		pins.WalkPins(func(name string, docs Docs) {
+			n.pins.addDocs(name, &docs)
+		})
+	}
+}
+
+// startupPins() answers the data I've received on startup pins.
+func (n *node_starting) startupPins() Pins {
+	ans := &pins{}
+	for _, name := range n.startup {
+		docs := n.pins.GetPin(name)
+		if len(docs.Docs) > 0 {
+			ans.addDocs(name, &docs)
+		}
+	}
+	return ans
+}
+
+// receivedPins() answers all the data I've received, including input
+// that arrived before the startup pins.
+func (n *node_starting) receivedPins() Pins {
+	ans := &pins{}
+	n.pins.WalkPins(func(name string, docs Docs) {
+		ans.addDocs(name, &docs)
+	})
+	return ans
+}
+
+// ready() answers true if my data matches the conditions required
+// by the underlying node to start.
+func (n *node_starting) ready() bool {
+	for _, name := range n.required {
+		if len(n.pins.GetPin(name).Docs) < 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// ----------------------------------------
+// PIPELINE-MSG
+
+type pipeline_msg struct {
+	Msg
+	Node string
+}
+
+func newPipelineMsg(m Msg, n string) *pipeline_msg {
+	return &pipeline_msg{m, n}
+}
+
+// ----------------------------------------
+// RUN-TRACER
+
+// run_tracer stamps each event with the time and running
+// pipeline before handing it to the client tracer and observer.
+type run_tracer struct {
+	pid      int32
+	tracer   Tracer
+	observer *observer_queue
+	nested   bool // The observer belongs to the pipeline running me, so my PipelineFinished isn't its last event
+}
+
+func (t run_tracer) trace(e TraceEvent) {
+	e.Time = time.Now()
+	e.Pipeline = t.pid
+	t.tracer.Trace(e)
+	if !t.nested || e.What != TracePipelineFinished {
+		t.observer.add(e)
+	}
+}
+
+// ----------------------------------------
+// OUTPUT-RESOLVER
+
+// outputResolver is used to convert a source node and output pin name
+// to all destination node and input pin names
+type outputResolver interface {
+	ResolveOutput(srcnode, srcpin string) ([]connectionDescr, error)
+}
+
+// ----------------------------------------
+// CONST and VAR
+
+const (
+	startup_edge = ".startup" // The edge for input from the runner itself
+	ins_node     = "ins"      // The source of input from my parent, in traces and edge names
+)
+
+var (
+	pipeline_starting = errors.New("ps")
+	pipeline_running  = errors.New("pr")
+)
+
+func pipelineRunFakeFmt() {
+	fmt.Println()
+}
@@ -0,0 +1,124 @@
+package phly
+
+import (
+	"github.com/micro-go/lock"
+	"sync"
+)
+
+// ----------------------------------------
+// WORKER-POOL
+
+// worker_pool processes node jobs on a fixed number of goroutines. It is
+// owned by the runner, which only starts a job when a worker is idle, so
+// neither starting nor finishing a job ever blocks. A worker whose node
+// is waiting on a full edge is lent out, which adds a goroutine until
+// the wait ends.
+type worker_pool struct {
+	jobs     chan *pipeline_job
+	finished chan *pipeline_job
+	idle     int
+	lent     int // Workers added for nodes waiting on a full edge
+	wait     sync.WaitGroup
+	mutex    sync.Mutex
+	surplus  int // Goroutines that exit after their current job, since their worker was reclaimed
+}
+
+func newWorkerPool(size int) *worker_pool {
+	if size < 1 {
+		size = 1
+	}
+	jobs := make(chan *pipeline_job, size)
+	finished := make(chan *pipeline_job, size)
+	w := &worker_pool{jobs: jobs, finished: finished, idle: size}
+	w.wait.Add(size)
+	for i := 0; i < size; i++ {
+		go w.work()
+	}
+	return w
+}
+
+func (w *worker_pool) work() {
+	defer w.wait.Done()
+	for job := range w.jobs {
+		if job.stage != "" {
+			job.err = job.node.signal(job.stage)
+		} else {
+			job.err = job.node.process(job.pins)
+		}
+		w.finished <- job
+		if w.retire() {
+			return
+		}
+	}
+}
+
+// start() hands the job to an idle worker. Clients must check idle first.
+func (w *worker_pool) start(job *pipeline_job) {
+	w.idle--
+	w.jobs <- job
+}
+
+// finish() returns the worker for a job received on the finished channel.
+func (w *worker_pool) finish(job *pipeline_job) {
+	w.idle++
+}
+
+// lend() adds a worker for one whose node is waiting on a full edge,
+// so the node it's waiting on can run.
+func (w *worker_pool) lend() {
+	w.idle++
+	w.lent++
+	w.wait.Add(1)
+	go w.work()
+}
+
+// reclaim() removes a lent worker once the wait has ended. A goroutine
+// exits the next time it finishes a job.
+func (w *worker_pool) reclaim() {
+	w.idle--
+	w.lent--
+	defer lock.Locker(&w.mutex).Unlock()
+	w.surplus++
+}
+
+// retire() answers true if the calling goroutine should exit.
+func (w *worker_pool) retire() bool {
+	defer lock.Locker(&w.mutex).Unlock()
+	if w.surplus < 1 {
+		return false
+	}
+	w.surplus--
+	return true
+}
+
+// close() waits for every running job to finish. The runner no longer
+// reads the finished channel, and lent workers can finish more jobs than
+// it holds, so it's drained here until the last worker exits.
+func (w *worker_pool) close() {
+	close(w.jobs)
+	done := make(chan struct{})
+	go func() {
+		w.wait.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-w.finished:
+		case <-done:
+			return
+		}
+	}
+}
+
+// ----------------------------------------
+// PIPELINE-JOB
+
+// pipeline_job is a single call to process a node, either with
+// input, or to signal a stage such as NodePausing.
+type pipeline_job struct {
+	name  string
+	node  *pipeline_running_node
+	pins  Pins
+	stage NodeStage // Set for signals, which have no pins
+	err   error
+}
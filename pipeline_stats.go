@@ -0,0 +1,205 @@
+package phly
+
+import (
+	"github.com/micro-go/lock"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------
+// PIPELINE-STATS
+
+// PipelineStats describes a single run of a pipeline.
+type PipelineStats struct {
+	Start time.Time            `json:"start"`
+	Stop  time.Time            `json:"stop"` // Zero while the pipeline is running
+	Nodes map[string]NodeStats `json:"nodes"`
+	Edges []EdgeStats          `json:"edges"` // Sorted by source then destination
+}
+
+// NodeStats describes everything a single node did during a run.
+// A node that is stopped and restarted is counted as one node.
+type NodeStats struct {
+	ProcessCalls int           `json:"process_calls"`
+	DocsIn       int           `json:"docs_in"`
+	ItemsIn      int           `json:"items_in"`
+	DocsOut      int           `json:"docs_out"`
+	ItemsOut     int           `json:"items_out"`
+	ProcessTime  time.Duration `json:"process_time"` // Wall time spent in Process
+	Start        time.Time     `json:"start"`        // When the node first started
+	Stop         time.Time     `json:"stop"`         // When the node last stopped
+}
+
+// EdgeStats describes the data that moved along a single connection.
+type EdgeStats struct {
+	SrcNode  string `json:"src_node"`
+	SrcPin   string `json:"src_pin"`
+	DstNode  string `json:"dst_node"`
+	DstPin   string `json:"dst_pin"`
+	Sends    int    `json:"sends"`
+	Docs     int    `json:"docs"`
+	Items    int    `json:"items"`
+	Depth    int    `json:"depth"`     // Input currently waiting on the edge
+	MaxDepth int    `json:"max_depth"` // The most input ever waiting on the edge
+}
+
+// ----------------------------------------
+// RUN-STATS
+
+// run_stats collects the stats for a runner. It is updated
+// from the runner, the workers and the nodes.
+type run_stats struct {
+	mutex sync.Mutex
+	start time.Time
+	stop  time.Time
+	nodes map[string]*NodeStats
+	edges map[connection_key]*EdgeStats
+}
+
+func newRunStats() *run_stats {
+	nodes := make(map[string]*NodeStats)
+	edges := make(map[connection_key]*EdgeStats)
+	return &run_stats{start: time.Now(), nodes: nodes, edges: edges}
+}
+
+// started() records the node receiving its startup pins.
+func (s *run_stats) started(node string) {
+	defer lock.Locker(&s.mutex).Unlock()
+	n := s.node(node)
+	if n.Start.IsZero() {
+		n.Start = time.Now()
+	}
+}
+
+// stopped() records the node being removed from the running graph.
+func (s *run_stats) stopped(node string) {
+	defer lock.Locker(&s.mutex).Unlock()
+	s.node(node).Stop = time.Now()
+}
+
+// received() records input handed to the node.
+func (s *run_stats) received(node string, pins Pins) {
+	docs, items := countPins(pins)
+	defer lock.Locker(&s.mutex).Unlock()
+	n := s.node(node)
+	n.DocsIn += docs
+	n.ItemsIn += items
+}
+
+// processed() records a single call to the node's Process.
+func (s *run_stats) processed(node string, d time.Duration) {
+	defer lock.Locker(&s.mutex).Unlock()
+	n := s.node(node)
+	n.ProcessCalls++
+	n.ProcessTime += d
+}
+
+// sent() records output from the node's pin, before it's routed.
+func (s *run_stats) sent(node string, docs Docs) {
+	items := countItems(docs)
+	defer lock.Locker(&s.mutex).Unlock()
+	n := s.node(node)
+	n.DocsOut += len(docs.Docs)
+	n.ItemsOut += items
+}
+
+// routed() records output that arrived at a single destination,
+// leaving the edge at depth.
+func (s *run_stats) routed(srcnode, srcpin string, dst connectionDescr, pins Pins, depth int) {
+	docs, items := countPins(pins)
+	defer lock.Locker(&s.mutex).Unlock()
+	key := connection_key{srcnode, srcpin, dst.DstNode, dst.DstPin}
+	e, ok := s.edges[key]
+	if !ok {
+		e = &EdgeStats{SrcNode: srcnode, SrcPin: srcpin, DstNode: dst.DstNode, DstPin: dst.DstPin}
+		s.edges[key] = e
+	}
+	e.Sends++
+	e.Docs += docs
+	e.Items += items
+	if depth > e.MaxDepth {
+		e.MaxDepth = depth
+	}
+}
+
+// finished() records the end of the run.
+func (s *run_stats) finished() {
+	defer lock.Locker(&s.mutex).Unlock()
+	s.stop = time.Now()
+}
+
+// get() answers a copy of the current stats.
+func (s *run_stats) get() PipelineStats {
+	defer lock.Locker(&s.mutex).Unlock()
+	ans := PipelineStats{Start: s.start, Stop: s.stop, Nodes: make(map[string]NodeStats)}
+	for k, v := range s.nodes {
+		ans.Nodes[k] = *v
+	}
+	for _, v := range s.edges {
+		ans.Edges = append(ans.Edges, *v)
+	}
+	sort.Sort(sortEdgeStats(ans.Edges))
+	return ans
+}
+
+func (s *run_stats) node(name string) *NodeStats {
+	n, ok := s.nodes[name]
+	if !ok {
+		n = &NodeStats{}
+		s.nodes[name] = n
+	}
+	return n
+}
+
+// connection_key identifies a single edge in the graph.
+type connection_key struct {
+	srcNode, srcPin, dstNode, dstPin string
+}
+
+// ----------------------------------------
+// MISC
+
+// countPins() answers the number of docs and items on all pins.
+func countPins(pins Pins) (int, int) {
+	docs, items := 0, 0
+	if pins != nil {
+		pins.WalkPins(func(name string, d Docs) {
+			docs += len(d.Docs)
+			items += countItems(d)
+		})
+	}
+	return docs, items
+}
+
+func countItems(docs Docs) int {
+	items := 0
+	for _, d := range docs.Docs {
+		if d != nil {
+			items += len(d.Items)
+		}
+	}
+	return items
+}
+
+// ----------------------------------------
+// SORT
+
+type sortEdgeStats []EdgeStats
+
+func (s sortEdgeStats) Len() int {
+	return len(s)
+}
+func (s sortEdgeStats) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortEdgeStats) Less(i, j int) bool {
+	a := []string{s[i].SrcNode, s[i].SrcPin, s[i].DstNode, s[i].DstPin}
+	b := []string{s[j].SrcNode, s[j].SrcPin, s[j].DstNode, s[j].DstPin}
+	for k := range a {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return false
+}
@@ -1,130 +1,2211 @@
-package phly
-
-import (
-	"fmt"
-	"strings"
-	"testing"
-)
-
-// ----------------------------------------
-// READ-PIPELINE
-
-func TestReadPipeline(t *testing.T) {
-	cases := []struct {
-		Pipeline string
-		WantErr  error
-	}{
-		{testPipelineBadData1, NewParseError(nil)},
-		{testPipelineBadData2, NewMissingError("")},
-		// XXX How should we do success tests?
-	}
-	for i, tc := range cases {
-		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			p := &pipeline{}
-			have_err := readPipeline(strings.NewReader(tc.Pipeline), p)
-			if !ErrorsEqual(have_err, tc.WantErr) {
-				fmt.Println("err mismatch\nhave\n", have_err, "\nwant\n", tc.WantErr)
-				t.Fatal()
-			}
-		})
-	}
-}
-
-// ----------------------------------------
-// RUN-PIPELINE
-
-func TestRunPipeline(t *testing.T) {
-	Register(&test_source_node{})
-
-	cases := []struct {
-		Pipeline string
-		Input    Pins
-		WantErr  error
-	}{
-		{testPipelineData1, nil, nil},
-	}
-	for i, tc := range cases {
-		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			p := &pipeline{}
-			have_err := readPipeline(strings.NewReader(tc.Pipeline), p)
-			if have_err != nil {
-				fmt.Println("err should be nil but is", have_err)
-				t.Fatal()
-			}
-			clas := make(map[string]string)
-			args := StartArgs{Cla: clas}
-			have_err = p.Run(args, tc.Input)
-			if !ErrorsEqual(have_err, tc.WantErr) {
-				fmt.Println("error mismatch\nhave\n", have_err, "\nwant\n", tc.WantErr)
-				t.Fatal()
-			}
-			//			t.Fatal()
-		})
-	}
-}
-
-// ----------------------------------------
-// TEST-SOURCE-NODE
-
-const (
-	testnode_start = "start"
-	testnode_in    = "in"
-	testnode_out   = "out"
-)
-
-// test_source_node is used solely in tests. It generates a value in the start and finishes.
-type test_source_node struct {
-	Items []interface{} `json:"items,omitempty"`
-}
-
-func (n *test_source_node) Describe() NodeDescr {
-	descr := NodeDescr{Id: "phly/test/source", Name: "Test Source", Purpose: "A source node for running tests."}
-	//	descr.InputPins = append(descr.InputPins, PinDescr{Name: testnode_in, Purpose: "Input."})
-	descr.OutputPins = append(descr.OutputPins, PinDescr{Name: testnode_out, Purpose: "Output."})
-	return descr
-}
-
-func (n *test_source_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
-	return &test_source_node{}, nil
-}
-
-func (n *test_source_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
-	fmt.Println("TEST NODE PROCESS", stage, "send", n.Items)
-	if len(n.Items) > 0 {
-		cmds := []interface{}{testnode_out}
-		cmds = append(cmds, n.Items...)
-		pins, err := BuildPins(cmds...)
-		if err != nil {
-			return err
-		}
-		output.SendPins(pins)
-	}
-	output.SendMsg(MsgFromStop(nil))
-	return nil
-}
-
-func (n *test_source_node) StopNode(args StoppedArgs) error {
-	fmt.Println("testing node stopped!")
-	return nil
-}
-
-// ----------------------------------------
-// CONST and VAR
-
-const (
-	// Search for 'Z' to see where the bad data is broken
-	testPipelineBadData1 = `{ "nodes": Z{ "test1": { "node": "phly/test/source", "cfg": { "runmode": "" } } } }`
-	testPipelineBadData2 = `{ "nodes": { "test1": { "node": "Zphly/test/source", "cfg": { "runmode": "" } } } }`
-
-	testPipelineData1 = `{
-	"nodes": {
-		"test1": {
-			"node": "phly/test/source",
-			"cfg": {
-				"runmode": "running",
-				"finish": ["finish"]
-			}
-		}
-	}
-}`
-)
+package phly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/micro-go/lock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ----------------------------------------
+// READ-PIPELINE
+
+func TestReadPipeline(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+	Register(&test_typed_node{})
+
+	cases := []struct {
+		Pipeline string
+		WantErr  error
+	}{
+		{testPipelineBadData1, NewParseError(nil)},
+		{testPipelineBadData2, NewMissingError("")},
+		{testPipelineLoop1, nil},
+		{testPipelineLoop2, &ValidateError{}},
+		{testPipelineLoop3, &ValidateError{}},
+		{testPipelineLoop4, NewBadRequestError("")},
+		{testPipelineTyped1, nil},
+		{testPipelineTyped2, &ValidateError{}},
+		// XXX How should we do success tests?
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p := &pipeline{}
+			have_err := readPipeline(strings.NewReader(tc.Pipeline), p)
+			if !ErrorsEqual(have_err, tc.WantErr) {
+				fmt.Println("err mismatch\nhave\n", have_err, "\nwant\n", tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestWritePipeline(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+
+	cases := []struct {
+		Pipeline string
+		Want     string
+	}{
+		{testPipelineOuts1, `{"outs":{"out":["src:out"]},"nodes":{"src":{"node":"phly/test/source","cfg":{"items":["a","b"]}}}}`},
+		{testPipelineLoop1, `{"outs":{"out":["a:out"]},"nodes":{"a":{"node":"phly/test/pass","maxIterations":3,"outs":{"out":["a:in"]}},"src":{"node":"phly/test/source","cfg":{"items":["a"]},"outs":{"out":["a:in"]}}}}`},
+		{testPipelineWrite1, `{"timeout":"1s","workers":"${cpus}","queue":{"capacity":2},"args":{"env":"PHLY_","strings":{"file":"a.txt"}},"ins":{"in":["b:in"]},"outs":{"out":["b:out"]},"nodes":{"a":{"node":"phly/test/pass","queue":{"overflow":"drop_oldest"},"onError":{"policy":"retry","count":2,"backoff":"10ms"},"ins":{"in":"args:file"},"outs":{"out":["b:in"]}},"b":{"node":"phly/test/pass"}}}`},
+		{testPipelineTypedArgs2, `{"args":{"typed":{"scale":{"type":"float","required":true}}},"outs":{"s":["s:out"]},"nodes":{"s":{"node":"phly/test/pass","ins":{"in":"args:scale"}}}}`},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p, err := ReadPipeline(strings.NewReader(tc.Pipeline))
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			var have bytes.Buffer
+			err = WritePipeline(&have, p)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			var compact bytes.Buffer
+			json.Compact(&compact, have.Bytes())
+			if compact.String() != tc.Want {
+				fmt.Println("write mismatch\nhave\n", compact.String(), "\nwant\n", tc.Want)
+				t.Fatal()
+			}
+			// Reading the output back answers the same pipeline
+			p, err = ReadPipeline(&have)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			have.Reset()
+			compact.Reset()
+			WritePipeline(&have, p)
+			json.Compact(&compact, have.Bytes())
+			if compact.String() != tc.Want {
+				fmt.Println("round trip mismatch\nhave\n", compact.String(), "\nwant\n", tc.Want)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestPipelineFormats(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+
+	cases := []struct {
+		Name     string
+		Pipeline string
+		WantErr  error
+		WantLine int
+		WantCol  int
+	}{
+		{"loop.json", testPipelineLoop1, nil, 0, 0},
+		{"loop.jsonc", testPipelineJsonc1, nil, 0, 0},
+		{"loop.yaml", testPipelineYaml1, nil, 0, 0},
+		{"loop.YML", testPipelineYaml1, nil, 0, 0},
+		{"bad.json", testPipelineJsonc1, NewParseError(nil), 2, 2},
+		{"bad.jsonc", "{\n\t// The nodes\n\t\"nodes\": [1 2]\n}", NewParseError(nil), 3, 14},
+		{"bad.yaml", "nodes:\n  a: b\n   c: d\n", NewParseError(nil), 3, 4},
+		{"type.yaml", "outs:\n  out: 5\n", NewParseError(nil), 2, 8},
+		{"type.yml", "queue:\n  capacity: [ 2 ]\n", NewParseError(nil), 2, 13},
+	}
+	var want bytes.Buffer
+	p, _ := ReadPipeline(strings.NewReader(testPipelineLoop1))
+	WritePipeline(&want, p)
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p, have_err := ReadPipeline(newNamedReader(tc.Name, []byte(tc.Pipeline)))
+			if !ErrorsEqual(have_err, tc.WantErr) {
+				fmt.Println("err mismatch\nhave\n", have_err, "\nwant\n", tc.WantErr)
+				t.Fatal()
+			}
+			if have_err != nil {
+				loc, _ := have_err.(*PhlyError).err.(*ParseLocationError)
+				if loc == nil || loc.Line != tc.WantLine || loc.Col != tc.WantCol {
+					fmt.Println("location mismatch\nhave\n", have_err, "\nwant\n", tc.WantLine, tc.WantCol)
+					t.Fatal()
+				}
+				return
+			}
+			// Every format reads to the same pipeline
+			var have bytes.Buffer
+			WritePipeline(&have, p)
+			if have.String() != want.String() {
+				fmt.Println("pipeline mismatch\nhave\n", have.String(), "\nwant\n", want.String())
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestValidatePipeline(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+	Register(&test_join_node{})
+
+	p := &pipeline{}
+	err := readPipeline(strings.NewReader(testPipelineValidate1), p)
+	verr, ok := err.(*ValidateError)
+	if !ok {
+		fmt.Println("err should be a ValidateError but is", err)
+		t.Fatal()
+	}
+	var have []string
+	for _, problem := range verr.Problems {
+		have = append(have, problem.String())
+	}
+	want := []string{
+		"a:in: error: Input from args:nofile, which isn't declared in args.strings or args.typed",
+		"c:out: warning: Output isn't connected",
+		"c:out: error: Output to missing node missing",
+		"d: warning: Node can never run, since no input reaches it",
+		"ins:in: error: Connects to a:nope, which isn't an input",
+		"j:a: error: Required startup pin isn't connected",
+		"j:out: warning: Output isn't connected",
+		"outs:out: error: Connects to missing node missing",
+	}
+	if strings.Join(have, "\n") != strings.Join(want, "\n") {
+		fmt.Println("problems mismatch\nhave\n", strings.Join(have, "\n"), "\nwant\n", strings.Join(want, "\n"))
+		t.Fatal()
+	}
+}
+
+// ----------------------------------------
+// ENGINE
+
+func TestEngine(t *testing.T) {
+	a, b := NewEngine(), NewEngine()
+	a.Register(&test_source_node{})
+	a.RegisterVar("who", "The engine", "a")
+	b.RegisterVar("who", "The engine", "b")
+
+	_, err := a.ReadPipeline(strings.NewReader(testPipelineEngine1))
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	_, err = b.ReadPipeline(strings.NewReader(testPipelineEngine1))
+	if !ErrorsEqual(err, NewMissingError("")) {
+		fmt.Println("err mismatch\nhave\n", err, "\nwant\n", NewMissingError(""))
+		t.Fatal()
+	}
+	have := a.Env().ReplaceVars("${who}") + b.Env().ReplaceVars("${who}")
+	if have != "ab" {
+		fmt.Println("vars mismatch\nhave\n", have, "\nwant\n", "ab")
+		t.Fatal()
+	}
+}
+
+// ----------------------------------------
+// PIPELINE-BUILDER
+
+func TestPipelineBuilder(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+
+	cases := []struct {
+		Build      func(b *PipelineBuilder)
+		WantOutput Pins
+		WantErr    error
+		WantWrite  string // The written pipeline, if set
+	}{
+		{func(b *PipelineBuilder) {
+			b.Node("src", "phly/test/source", &test_source_node{Items: []interface{}{"a", "b"}})
+			b.Node("pass", "phly/test/pass", nil)
+			b.Connect("src:out", "pass:in").Out("out", "pass:out")
+		}, MustBuildPins("out", "a", "b"), nil, ""},
+		{func(b *PipelineBuilder) {
+			b.Node("src", "phly/test/source", nil).Connect("src:out", "pass:in")
+		}, nil, &ValidateError{}, ""},
+		{func(b *PipelineBuilder) {
+			b.Node("src", "phly/test/source", nil).Node("src", "phly/test/pass", nil)
+		}, nil, NewBadRequestError(""), ""},
+		// A cycle is bounded by the node's settings.
+		{func(b *PipelineBuilder) {
+			b.Node("src", "phly/test/source", &test_source_node{Items: []interface{}{"a"}})
+			b.Node("a", "phly/test/pass", nil).Settings("a", NodeSettings{MaxIterations: 3})
+			b.Connect("src:out", "a:in").Connect("a:out", "a:in").Out("out", "a:out")
+		}, MustBuildPins(PbsChan, "out", "a", PbsDoc, "a", PbsDoc, "a", PbsDoc, "a"), nil, ""},
+		{func(b *PipelineBuilder) {
+			b.Timeout(time.Second).Workers(2).Queue(2, OverflowBlock)
+			b.TypedArg("word", ArgSettings{Type: "enum", Default: "hi", Values: []interface{}{"hi", "bye"}})
+			b.Node("a", "phly/test/pass", nil)
+			b.Settings("a", NodeSettings{Overflow: OverflowDropOldest, OnError: ErrorRetry, RetryCount: 2, RetryBackoff: 10 * time.Millisecond})
+			b.Connect("args:word", "a:in").Out("out", "a:out")
+		}, MustBuildPins("out", "hi"), nil, `{"timeout":"1s","workers":"2","queue":{"capacity":2,"overflow":"block"},"args":{"typed":{"word":{"type":"enum","default":"hi","values":["hi","bye"]}}},"outs":{"out":["a:out"]},"nodes":{"a":{"node":"phly/test/pass","queue":{"overflow":"drop_oldest"},"onError":{"policy":"retry","count":2,"backoff":"10ms"},"ins":{"in":"args:word"}}}}`},
+		{func(b *PipelineBuilder) {
+			b.Settings("a", NodeSettings{MaxIterations: 3})
+		}, nil, NewMissingError(""), ""},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			b := NewPipelineBuilder()
+			tc.Build(b)
+			p, have_err := b.Build()
+			if !ErrorsEqual(have_err, tc.WantErr) {
+				fmt.Println("error mismatch\nhave\n", have_err, "\nwant\n", tc.WantErr)
+				t.Fatal()
+			}
+			if have_err != nil {
+				return
+			}
+			if tc.WantWrite != "" {
+				var have, compact bytes.Buffer
+				WritePipeline(&have, p)
+				json.Compact(&compact, have.Bytes())
+				if compact.String() != tc.WantWrite {
+					fmt.Println("write mismatch\nhave\n", compact.String(), "\nwant\n", tc.WantWrite)
+					t.Fatal()
+				}
+			}
+			have_output, have_err := p.Run(context.Background(), StartArgs{}, nil)
+			if have_err != nil {
+				fmt.Println("err should be nil but is", have_err)
+				t.Fatal()
+			}
+			if !StringPinsEqual(have_output, tc.WantOutput) {
+				fmt.Println("output mismatch\nhave\n", StringPinsToJson(have_output), "\nwant\n", StringPinsToJson(tc.WantOutput))
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ----------------------------------------
+// RUN-PIPELINE
+
+func TestRunPipeline(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_join_node{})
+	Register(&test_wait_node{})
+	Register(&test_later_node{})
+	Register(&test_fail_node{})
+	Register(&test_panic_node{})
+	Register(&test_pass_node{})
+	Register(&test_typed_node{})
+
+	cases := []struct {
+		Pipeline   string
+		Input      Pins
+		WantOutput Pins
+		WantErr    error
+	}{
+		{testPipelineData1, nil, MustBuildPins(), nil},
+		{testPipelineOuts1, nil, MustBuildPins("out", "a", "b"), nil},
+		{testPipelineStartup1, nil, MustBuildPins(PbsChan, "out", "1", PbsDoc, "2"), nil},
+		{testPipelineStartup2, nil, MustBuildPins("out", "1"), nil},
+		{testPipelineTimeout1, nil, MustBuildPins(), context.DeadlineExceeded},
+		{testPipelineLater1, nil, MustBuildPins("out", "later"), nil},
+		{testPipelineOnError1, nil, MustBuildPins(), errors.New("fail")},
+		{testPipelineOnError2, nil, MustBuildPins(), nil},
+		{testPipelineOnError3, nil, MustBuildPins("out", "ok"), nil},
+		{testPipelineOnError4, nil, MustBuildPins(), errors.New("fail")},
+		{testPipelineOnError5, nil, MustBuildPins("err", "fail"), nil},
+		{testPipelineOnError6, nil, MustBuildPins("out", "a"), nil},
+		{testPipelinePanic1, nil, MustBuildPins(), NewPanicError("", "", nil, nil)},
+		{testPipelinePanic2, nil, MustBuildPins(), nil},
+		{testPipelinePanic3, nil, MustBuildPins("out", "ok"), nil},
+		{testPipelineLoop1, nil, MustBuildPins(PbsChan, "out", "a", PbsDoc, "a", PbsDoc, "a", PbsDoc, "a"), nil},
+		{testPipelineTyped3, nil, MustBuildPins("out", "typed"), nil},
+		{testPipelineTyped4, nil, MustBuildPins(), NewMimeTypeError("")},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p := &pipeline{}
+			have_err := readPipeline(strings.NewReader(tc.Pipeline), p)
+			if have_err != nil {
+				fmt.Println("err should be nil but is", have_err)
+				t.Fatal()
+			}
+			clas := make(map[string]string)
+			args := StartArgs{Cla: clas}
+			have_output, have_err := p.Run(context.Background(), args, tc.Input)
+			if !ErrorsEqual(have_err, tc.WantErr) {
+				fmt.Println("error mismatch\nhave\n", have_err, "\nwant\n", tc.WantErr)
+				t.Fatal()
+			}
+			if !StringPinsEqual(have_output, tc.WantOutput) {
+				fmt.Println("output mismatch\nhave\n", StringPinsToJson(have_output), "\nwant\n", StringPinsToJson(tc.WantOutput))
+				t.Fatal()
+			}
+			//			t.Fatal()
+		})
+	}
+}
+
+// ----------------------------------------
+// NESTED-PIPELINE
+
+func TestNestedPipeline(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+	Register(&test_fail_node{})
+	Register(&test_later_node{})
+
+	dir, err := ioutil.TempDir("", "phly")
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	defer os.RemoveAll(dir)
+	inner := map[string]string{"pass.json": testPipelineInnerPass1, "fail.json": testPipelineInnerFail1, "args.json": testPipelineInnerArgs1, "failslow.json": testPipelineInnerFailSlow1}
+	for name, data := range inner {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+	}
+
+	cases := []struct {
+		Pipeline   string
+		Cla        map[string]string
+		WantOutput Pins
+		WantErr    error
+	}{
+		{testPipelineNested1, nil, MustBuildPins("out", "a", "b"), nil},
+		{testPipelineNested2, nil, MustBuildPins(), errors.New("fail")},
+		{testPipelineNested3, nil, MustBuildPins("err", "fail"), nil},
+		{testPipelineNested4, nil, MustBuildPins(PbsChan, "out", "a", PbsDoc, "later"), nil},
+		{testPipelineNested5, nil, MustBuildPins("out", "later"), nil},
+		{testPipelineNestedArgs1, nil, MustBuildPins(PbsChan, "default", "inner", PbsChan, "set", "outer"), nil},
+		{testPipelineNestedArgs1, map[string]string{"item": "cla"}, MustBuildPins(PbsChan, "default", "cla", PbsChan, "set", "outer"), nil},
+		{testPipelineNestedArgs2, nil, nil, NewBadRequestError("")},
+		{testPipelineNestedArgs3, nil, MustBuildPins("out", "w-x"), nil},
+		{testPipelineNestedArgs3, map[string]string{"w": "cla"}, MustBuildPins("out", "cla-x"), nil},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			src := strings.Replace(tc.Pipeline, "${dir}", filepath.ToSlash(dir), -1)
+			p, have_err := ReadPipeline(strings.NewReader(src))
+			if tc.WantOutput == nil {
+				if !ErrorsEqual(have_err, tc.WantErr) {
+					fmt.Println("read error mismatch\nhave\n", have_err, "\nwant\n", tc.WantErr)
+					t.Fatal()
+				}
+				return
+			}
+			if have_err != nil {
+				fmt.Println("err should be nil but is", have_err)
+				t.Fatal()
+			}
+			have_output, have_err := p.Run(context.Background(), StartArgs{Cla: tc.Cla}, nil)
+			if !ErrorsEqual(have_err, tc.WantErr) {
+				fmt.Println("error mismatch\nhave\n", have_err, "\nwant\n", tc.WantErr)
+				t.Fatal()
+			}
+			if !StringPinsEqual(have_output, tc.WantOutput) {
+				fmt.Println("output mismatch\nhave\n", StringPinsToJson(have_output), "\nwant\n", StringPinsToJson(tc.WantOutput))
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ----------------------------------------
+// TYPED-ARGS
+
+func TestTypedArgs(t *testing.T) {
+	Register(&test_pass_node{})
+
+	cases := []struct {
+		Pipeline  string
+		Cla       map[string]string
+		WantItems string
+		WantErr   error
+	}{
+		{testPipelineTypedArgs1, nil, "w=int 100;t=[]string [a b];m=string fit", nil},
+		{testPipelineTypedArgs1, map[string]string{"width": "25", "tags": "c", "mode": "fill"}, "w=int 25;t=[]string [c];m=string fill", nil},
+		{testPipelineTypedArgs1, map[string]string{"width": "wide"}, "", NewBadRequestError("")},
+		{testPipelineTypedArgs1, map[string]string{"mode": "stretch"}, "", NewBadRequestError("")},
+		{testPipelineTypedArgs2, nil, "", NewMissingError("")},
+		{testPipelineTypedArgs2, map[string]string{"scale": "0.5"}, "s=float64 0.5", nil},
+		{testPipelineTypedArgs3, nil, "", NewBadRequestError("")},
+		{testPipelineTypedArgs4, nil, "c=string 4", nil},
+		{testPipelineTypedArgs4, map[string]string{"count": "5"}, "c=string 5", nil},
+		{testPipelineTypedArgs5, nil, "", NewBadRequestError("")},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p, have_err := ReadPipeline(strings.NewReader(tc.Pipeline))
+			if have_err == nil {
+				var output Pins
+				output, have_err = p.Run(context.Background(), StartArgs{Cla: tc.Cla}, nil)
+				if have_err == nil {
+					var have []string
+					for _, name := range []string{"w", "t", "m", "s", "c"} {
+						for _, doc := range output.GetPin(name).Docs {
+							for _, item := range doc.Items {
+								have = append(have, fmt.Sprintf("%v=%T %v", name, item, item))
+							}
+						}
+					}
+					if strings.Join(have, ";") != tc.WantItems {
+						fmt.Println("items mismatch\nhave\n", strings.Join(have, ";"), "\nwant\n", tc.WantItems)
+						t.Fatal()
+					}
+				}
+			}
+			if !ErrorsEqual(have_err, tc.WantErr) {
+				fmt.Println("err mismatch\nhave\n", have_err, "\nwant\n", tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ----------------------------------------
+// CONCURRENT-PIPELINES
+
+func TestConcurrentPipelines(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_later_node{})
+
+	cases := []struct {
+		Pipeline   string
+		WantOutput Pins
+	}{
+		{testPipelineOuts1, MustBuildPins("out", "a", "b")},
+		{testPipelineLater1, MustBuildPins("out", "later")},
+	}
+	// Every pipeline runs at once, several times, and each must finish
+	// with its own output no matter what the others are doing.
+	var wait sync.WaitGroup
+	errs := make(chan error, len(cases)*4)
+	for i := 0; i < 4; i++ {
+		for _, tc := range cases {
+			wait.Add(1)
+			go func(cfg string, want Pins) {
+				defer wait.Done()
+				p := &pipeline{}
+				err := readPipeline(strings.NewReader(cfg), p)
+				if err != nil {
+					errs <- err
+					return
+				}
+				have, err := p.Run(context.Background(), StartArgs{}, nil)
+				if err != nil {
+					errs <- err
+				} else if !StringPinsEqual(have, want) {
+					errs <- errors.New("output mismatch have " + StringPinsToJson(have) + " want " + StringPinsToJson(want))
+				}
+			}(tc.Pipeline, tc.WantOutput)
+		}
+	}
+	wait.Wait()
+	close(errs)
+	for err := range errs {
+		fmt.Println(err)
+		t.Fatal()
+	}
+}
+
+// ----------------------------------------
+// OBSERVER
+
+func TestObserver(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+
+	p := &pipeline{}
+	err := readPipeline(strings.NewReader(testPipelineStats1), p)
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	// The observer blocks until the run is done, which must not block the runner.
+	o := &test_observer{release: make(chan struct{}), finished: make(chan struct{})}
+	_, err = p.Run(context.Background(), StartArgs{Observer: o}, nil)
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	close(o.release)
+	<-o.finished
+
+	// Nodes run concurrently, so only check the order that's guaranteed.
+	order := [][]string{
+		{"started src", "routed src:out->pass:in", "started pass", "routed pass:out->.pipeline:out", "stopped pass", "finished"},
+		{"routed src:out->pass:in", "stopped src", "finished"},
+	}
+	index := make(map[string]int)
+	for i, e := range o.events {
+		index[e] = i
+	}
+	if len(o.events) != 7 || o.events[6] != "finished" {
+		fmt.Println("events mismatch", o.events)
+		t.Fatal()
+	}
+	for _, events := range order {
+		for i := 1; i < len(events); i++ {
+			a, aok := index[events[i-1]]
+			b, bok := index[events[i]]
+			if !aok || !bok || a > b {
+				fmt.Println("events out of order", events[i-1], events[i], o.events)
+				t.Fatal()
+			}
+		}
+	}
+}
+
+func TestNestedObserver(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+
+	dir, err := ioutil.TempDir("", "phly")
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "pass.json"), []byte(testPipelineInnerPass1), 0644)
+	src := strings.Replace(testPipelineNested1, "${dir}", filepath.ToSlash(dir), -1)
+	p, err := ReadPipeline(strings.NewReader(src))
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	o := &test_observer{release: make(chan struct{}), finished: make(chan struct{})}
+	close(o.release)
+	_, err = p.Run(context.Background(), StartArgs{Observer: o}, nil)
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	<-o.finished
+
+	// The events of both pipelines arrive in order, and only the outer one finishes.
+	order := []string{"started pass", "routed pass:out->.pipeline:out", "routed nested:out->.pipeline:out", "stopped nested", "finished"}
+	index := make(map[string]int)
+	for i, e := range o.events {
+		index[e] = i
+	}
+	if o.events[len(o.events)-1] != "finished" || index["finished"] != len(o.events)-1 {
+		fmt.Println("events mismatch", o.events)
+		t.Fatal()
+	}
+	for i := 1; i < len(order); i++ {
+		a, aok := index[order[i-1]]
+		b, bok := index[order[i]]
+		if !aok || !bok || a > b {
+			fmt.Println("events out of order", order[i-1], order[i], o.events)
+			t.Fatal()
+		}
+	}
+}
+
+// test_observer records a description of each event.
+type test_observer struct {
+	release  chan struct{}
+	finished chan struct{}
+	events   []string // Only the delivering goroutine writes, and only the test reads after finished
+}
+
+func (o *test_observer) NodeStarted(e TraceEvent) {
+	<-o.release
+	o.events = append(o.events, "started "+e.Node)
+}
+
+func (o *test_observer) NodeStopped(e TraceEvent) {
+	o.events = append(o.events, "stopped "+e.Node)
+}
+
+func (o *test_observer) PinsRouted(e TraceEvent) {
+	o.events = append(o.events, "routed "+e.Node+":"+e.Pin+"->"+e.DstNode+":"+e.DstPin)
+}
+
+func (o *test_observer) NodeError(e TraceEvent) {
+	o.events = append(o.events, "error "+e.Node)
+}
+
+func (o *test_observer) PipelineFinished(e TraceEvent) {
+	o.events = append(o.events, "finished")
+	close(o.finished)
+}
+
+// ----------------------------------------
+// PAUSE
+
+func TestPause(t *testing.T) {
+	Register(&test_later_node{})
+	Register(&test_pass_node{})
+	Register(&test_pausable_node{})
+
+	p := &pipeline{}
+	err := readPipeline(strings.NewReader(testPipelinePause1), p)
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	err = p.Start(context.Background(), StartArgs{}, nil)
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	defer p.Stop()
+	// Pause once the pausable node is running, so it receives the stages.
+	for i := 0; i < 100 && p.Stats().Nodes["wait"].Start.IsZero(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	p.Pause()
+
+	// The later node sends after 100ms, which the pass node must not receive while paused.
+	time.Sleep(200 * time.Millisecond)
+	if calls := p.Stats().Nodes["pass"].ProcessCalls; calls != 0 {
+		fmt.Println("pass processed while paused", calls)
+		t.Fatal()
+	}
+	p.Resume()
+	for i := 0; i < 100 && p.Stats().Nodes["pass"].ProcessCalls < 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if calls := p.Stats().Nodes["pass"].ProcessCalls; calls != 1 {
+		fmt.Println("pass not processed after resume", calls)
+		t.Fatal()
+	}
+	pausable := p.nodes["wait"].node.(*test_pausable_node)
+	for i := 0; i < 100 && len(pausable.getStages()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	have := fmt.Sprint(pausable.getStages())
+	want := fmt.Sprint([]NodeStage{NodePausing, NodeResuming})
+	if have != want {
+		fmt.Println("stages mismatch\nhave\n", have, "\nwant\n", want)
+		t.Fatal()
+	}
+}
+
+// ----------------------------------------
+// CHECKPOINT
+
+func TestCheckpoint(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_later_node{})
+	Register(&test_pass_node{})
+	Register(&test_fail_node{})
+
+	cases := []struct {
+		Pipeline    string
+		Ready       func(PipelineStats) bool // Checkpoint once this answers true
+		WantStopped string
+		WantOutput  Pins
+	}{
+		// Checkpoint once the source is done, while the later node is still waiting.
+		{testPipelineCheckpoint1, func(s PipelineStats) bool { return !s.Nodes["pass"].Stop.IsZero() }, "[pass src]",
+			PinBuilder{}.Add("out", &Doc{Items: []interface{}{1.0, "a"}}).Add("out", &Doc{Items: []interface{}{"later"}}).Pins()},
+		// Checkpoint once the fail node has input, while it still waits on its startup pin.
+		{testPipelineCheckpoint2, func(s PipelineStats) bool { return s.Nodes["fail"].DocsIn > 0 }, "[src]",
+			MustBuildPins("out", "a")},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p := &pipeline{}
+			err := readPipeline(strings.NewReader(tc.Pipeline), p)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			err = p.Start(context.Background(), StartArgs{}, nil)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			for i := 0; i < 100 && !tc.Ready(p.Stats()); i++ {
+				time.Sleep(time.Millisecond)
+			}
+			c, err := p.Checkpoint()
+			p.Stop()
+			p.Wait()
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			var buf strings.Builder
+			err = WriteCheckpoint(&buf, c)
+			if err == nil {
+				c, err = ReadCheckpoint(strings.NewReader(buf.String()))
+			}
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			if fmt.Sprint(c.Stopped) != tc.WantStopped {
+				fmt.Println("stopped mismatch\nhave\n", c.Stopped, "\nwant\n", tc.WantStopped)
+				t.Fatal()
+			}
+
+			// Resuming doesn't run the source again, and keeps the earlier output.
+			p = &pipeline{}
+			err = readPipeline(strings.NewReader(tc.Pipeline), p)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			have, err := p.Run(context.Background(), StartArgs{Resume: c}, nil)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			if !StringPinsEqual(have, tc.WantOutput) {
+				fmt.Println("output mismatch\nhave\n", StringPinsToJson(have), "\nwant\n", StringPinsToJson(tc.WantOutput))
+				t.Fatal()
+			}
+			if calls := p.Stats().Nodes["src"].ProcessCalls; calls != 0 {
+				fmt.Println("src processed on resume", calls)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestPinsToJson(t *testing.T) {
+	tm := time.Date(2019, 3, 1, 12, 30, 0, 0, time.UTC)
+	cases := []struct {
+		Item interface{}
+		Want string
+	}{
+		{"a", `{"out":[{"mimetype":"test","items":["a"]}]}`},
+		{int(3), `{"out":[{"mimetype":"test","items":[3]}]}`},
+		{[]string{"a", "b"}, `{"out":[{"mimetype":"test","items":[["a","b"]]}]}`},
+		{tm, `{"out":[{"mimetype":"test","items":["2019-03-01T12:30:00Z"]}]}`},
+		{map[string]interface{}{"n": int(2)}, `{"out":[{"mimetype":"test","items":[{"n":2}]}]}`},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			doc := &Doc{MimeType: "test"}
+			doc.AppendItem(tc.Item)
+			data, err := PinsToJson(PinBuilder{}.Add("out", doc).Pins())
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			if string(data) != tc.Want {
+				fmt.Println("json mismatch\nhave\n", string(data), "\nwant\n", tc.Want)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestCheckpointItems(t *testing.T) {
+	tm := time.Date(2019, 3, 1, 12, 30, 0, 5, time.UTC)
+	cases := []struct {
+		Item interface{}
+	}{
+		{"a"},
+		{1.5},
+		{true},
+		{nil},
+		{int(-3)},
+		{int64(1 << 62)},
+		{uint32(7)},
+		{float32(0.5)},
+		{[]string{"a", "b"}},
+		{[]byte("bytes")},
+		{tm},
+		{250 * time.Millisecond},
+		{map[string]interface{}{"n": int(2), "s": "b"}},
+		{[]interface{}{int(1), "a"}},
+		// Maps that look like the encoding are still maps.
+		{map[string]interface{}{"type": "int", "value": "3"}},
+		{map[string]interface{}{"$type": "int", "$value": "3"}},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			doc := &Doc{MimeType: "test"}
+			doc.AppendItem(tc.Item)
+			var buf bytes.Buffer
+			err := WriteCheckpoint(&buf, &Checkpoint{Output: PinBuilder{}.Add("out", doc).Pins()})
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			c, err := ReadCheckpoint(&buf)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			docs := c.Output.GetPin("out")
+			if len(docs.Docs) != 1 || len(docs.Docs[0].Items) != 1 || docs.Docs[0].MimeType != "test" {
+				fmt.Println("doc mismatch", docs)
+				t.Fatal()
+			}
+			have := docs.Docs[0].Items[0]
+			if !reflect.DeepEqual(have, tc.Item) {
+				fmt.Printf("item mismatch\nhave\n %#v\nwant\n %#v\n", have, tc.Item)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ----------------------------------------
+// DRY-RUN
+
+func TestDryRun(t *testing.T) {
+	Register(&test_write_node{})
+
+	cases := []struct {
+		Pipeline    string
+		DryRun      bool
+		WantWritten []string
+		WantPlan    string
+	}{
+		{testPipelineDryRun1, false, []string{"a.txt"}, `{"args":{"file":"a.txt"},"nodes":[{"name":"write","id":"phly/test/write","cfg":{"file":"a.txt"}}]}`},
+		{testPipelineDryRun1, true, nil, `{"args":{"file":"a.txt"},"nodes":[{"name":"write","id":"phly/test/write","cfg":{"file":"a.txt"},"actions":["write a.txt"]}]}`},
+		{testPipelineDryRun2, true, nil, `{"nodes":[{"name":"write","id":"phly/test/write","cfg":{"file":"` + runtime.GOOS + `.txt"},"actions":["write ${os}.txt"]}]}`},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p := &pipeline{}
+			err := readPipeline(strings.NewReader(tc.Pipeline), p)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			test_written = nil
+			_, err = p.Run(context.Background(), StartArgs{DryRun: tc.DryRun}, nil)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			if fmt.Sprint(test_written) != fmt.Sprint(tc.WantWritten) {
+				fmt.Println("written mismatch\nhave\n", test_written, "\nwant\n", tc.WantWritten)
+				t.Fatal()
+			}
+			have_plan, _ := json.Marshal(p.Plan())
+			if string(have_plan) != tc.WantPlan {
+				fmt.Println("plan mismatch\nhave\n", string(have_plan), "\nwant\n", tc.WantPlan)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ----------------------------------------
+// PIPELINE-STATS
+
+func TestPipelineStats(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+
+	p := &pipeline{}
+	err := readPipeline(strings.NewReader(testPipelineStats1), p)
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	_, err = p.Run(context.Background(), StartArgs{}, nil)
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	stats := p.Stats()
+	src, pass := stats.Nodes["src"], stats.Nodes["pass"]
+	if src.ProcessCalls != 1 || src.DocsOut != 1 || src.ItemsOut != 2 || src.Start.IsZero() || src.Stop.IsZero() {
+		fmt.Println("src stats mismatch", src)
+		t.Fatal()
+	}
+	if pass.ProcessCalls != 1 || pass.DocsIn != 1 || pass.ItemsIn != 2 || pass.ItemsOut != 2 {
+		fmt.Println("pass stats mismatch", pass)
+		t.Fatal()
+	}
+	want_edges := []EdgeStats{
+		{SrcNode: "pass", SrcPin: "out", DstNode: pipeline_container.name, DstPin: "out", Sends: 1, Docs: 1, Items: 2},
+		{SrcNode: "src", SrcPin: "out", DstNode: "pass", DstPin: "in", Sends: 1, Docs: 1, Items: 2, MaxDepth: 1},
+	}
+	if fmt.Sprint(stats.Edges) != fmt.Sprint(want_edges) {
+		fmt.Println("edge stats mismatch\nhave\n", stats.Edges, "\nwant\n", want_edges)
+		t.Fatal()
+	}
+	if stats.Stop.Before(stats.Start) {
+		fmt.Println("stop is before start", stats.Start, stats.Stop)
+		t.Fatal()
+	}
+}
+
+// ----------------------------------------
+// NODE-INBOX
+
+func TestNodeInbox(t *testing.T) {
+	cases := []struct {
+		Cfg       queuecfg
+		Push      []string
+		WantErr   error
+		WantItems []string
+	}{
+		{queuecfg{2, OverflowBlock}, []string{"a", "b", "c"}, nil, []string{"a", "b", "c"}},
+		{queuecfg{2, OverflowDropOldest}, []string{"a", "b", "c"}, nil, []string{"b", "c"}},
+		{queuecfg{2, OverflowFail}, []string{"a", "b", "c"}, NewOverflowError(""), []string{"a", "b"}},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			inbox := newNodeInbox(tc.Cfg)
+			var have_err error
+			for _, item := range tc.Push {
+				// Never block, so the block policy is allowed to exceed its capacity.
+				_, _, err := inbox.push("e", MustBuildPins(testnode_in, item), false, nil)
+				have_err = MergeErrors(have_err, err)
+			}
+			if !ErrorsEqual(have_err, tc.WantErr) {
+				fmt.Println("err mismatch\nhave\n", have_err, "\nwant\n", tc.WantErr)
+				t.Fatal()
+			}
+			var have_items []string
+			for pins, ok := inbox.pop(); ok; pins, ok = inbox.pop() {
+				docs := pins.GetPin(testnode_in)
+				have_items = append(have_items, docs.StringItems()...)
+			}
+			if strings.Join(have_items, ",") != strings.Join(tc.WantItems, ",") {
+				fmt.Println("items mismatch\nhave\n", have_items, "\nwant\n", tc.WantItems)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ----------------------------------------
+// QUEUE-BLOCK
+
+func TestQueueBlock(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+	Register(&test_burst_node{})
+
+	cases := []struct {
+		Pipeline  string
+		WantItems int
+		WantEdge  EdgeStats
+	}{
+		// Sending from inside Process waits for the receiver, even with a single worker.
+		{testPipelineQueueBlock1, 4, EdgeStats{SrcNode: "burst", SrcPin: "out", DstNode: "pass", DstPin: "in", Sends: 4, Docs: 4, Items: 4, MaxDepth: 1}},
+		// A node sending to itself can never get room, so the edge exceeds its capacity.
+		{testPipelineQueueBlock2, 0, EdgeStats{SrcNode: "burst", SrcPin: "out", DstNode: "burst", DstPin: "in", Sends: 3, Docs: 3, Items: 3, MaxDepth: 3}},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p := &pipeline{}
+			err := readPipeline(strings.NewReader(tc.Pipeline), p)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			output, err := p.Run(context.Background(), StartArgs{}, nil)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			have_items := 0
+			if output != nil {
+				docs := output.GetPin("out")
+				have_items = countItems(docs)
+			}
+			if have_items != tc.WantItems {
+				fmt.Println("items mismatch\nhave\n", have_items, "\nwant\n", tc.WantItems)
+				t.Fatal()
+			}
+			var have_edge EdgeStats
+			for _, e := range p.Stats().Edges {
+				if e.SrcNode == tc.WantEdge.SrcNode && e.DstNode == tc.WantEdge.DstNode {
+					have_edge = e
+				}
+			}
+			if have_edge != tc.WantEdge {
+				fmt.Println("edge mismatch\nhave\n", have_edge, "\nwant\n", tc.WantEdge)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// TestQueueBlockShutdown makes sure a run that ends while a node waits on a
+// full edge still returns, after the wait lent out its worker.
+func TestQueueBlockShutdown(t *testing.T) {
+	Register(&test_burst_node{})
+
+	p := &pipeline{}
+	err := readPipeline(strings.NewReader(testPipelineQueueBlock3), p)
+	if err != nil {
+		fmt.Println("err should be nil but is", err)
+		t.Fatal()
+	}
+	have_err := make(chan error, 1)
+	go func() {
+		_, err := p.Run(context.Background(), StartArgs{}, nil)
+		have_err <- err
+	}()
+	select {
+	case err = <-have_err:
+	case <-time.After(5 * time.Second):
+		fmt.Println("run never returned")
+		t.Fatal()
+	}
+	if err != context.DeadlineExceeded {
+		fmt.Println("err mismatch\nhave\n", err, "\nwant\n", context.DeadlineExceeded)
+		t.Fatal()
+	}
+}
+
+// ----------------------------------------
+// WORKERS
+
+func TestWorkers(t *testing.T) {
+	Register(&test_busy_node{})
+
+	cases := []struct {
+		Pipeline      string
+		Barrier       int // Busy nodes wait until this many are processing at once
+		WantMinActive int
+		WantMaxActive int
+	}{
+		{testPipelineWorkers1, 0, 1, 1},
+		{testPipelineWorkers4, 2, 2, 4},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p := &pipeline{}
+			err := readPipeline(strings.NewReader(tc.Pipeline), p)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			test_busy = test_busy_t{barrier: tc.Barrier}
+			_, err = p.Run(context.Background(), StartArgs{}, nil)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			if test_busy.max < tc.WantMinActive || test_busy.max > tc.WantMaxActive {
+				fmt.Println("max active mismatch\nhave\n", test_busy.max, "\nwant\n", tc.WantMinActive, "to", tc.WantMaxActive)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ----------------------------------------
+// TRACE-PIPELINE
+
+func TestTracePipeline(t *testing.T) {
+	Register(&test_source_node{})
+
+	cases := []struct {
+		Pipeline string
+		Want     []TraceWhat
+	}{
+		{testPipelineOuts1, []TraceWhat{TraceNodeCreated, TraceNodeStarted, TracePinsRouted, TraceNodeStopped, TracePipelineFinished}},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p := &pipeline{}
+			err := readPipeline(strings.NewReader(tc.Pipeline), p)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			tracer := &test_tracer{}
+			_, err = p.Run(context.Background(), StartArgs{Tracer: tracer}, nil)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			have := tracer.whats()
+			if fmt.Sprint(have) != fmt.Sprint(tc.Want) {
+				fmt.Println("mismatch\nhave\n", have, "\nwant\n", tc.Want)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// test_tracer records the events it receives.
+type test_tracer struct {
+	mutex  sync.Mutex
+	events []TraceEvent
+}
+
+func (t *test_tracer) Trace(e TraceEvent) {
+	defer lock.Locker(&t.mutex).Unlock()
+	t.events = append(t.events, e)
+}
+
+func (t *test_tracer) whats() []TraceWhat {
+	defer lock.Locker(&t.mutex).Unlock()
+	var ans []TraceWhat
+	for _, e := range t.events {
+		ans = append(ans, e.What)
+	}
+	return ans
+}
+
+// ----------------------------------------
+// RESOLVE-OUTPUT
+
+func TestResolveOutput(t *testing.T) {
+	Register(&test_source_node{})
+	Register(&test_pass_node{})
+
+	cases := []struct {
+		Pipeline string
+		SrcNode  string
+		SrcPin   string
+		Want     []connectionDescr
+	}{
+		{testPipelineFanOut1, "src", "out", []connectionDescr{{"a", "in"}}},
+		{testPipelineFanOut2, "src", "out", []connectionDescr{{"a", "in"}, {"b", "in"}}},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p := &pipeline{}
+			err := readPipeline(strings.NewReader(tc.Pipeline), p)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			have, err := p.ResolveOutput(tc.SrcNode, tc.SrcPin)
+			if err != nil {
+				fmt.Println("err should be nil but is", err)
+				t.Fatal()
+			}
+			if !connectionDescrsEqual(have, tc.Want) {
+				fmt.Println("mismatch\nhave\n", have, "\nwant\n", tc.Want)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func connectionDescrsEqual(a, b []connectionDescr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	found := make(map[connectionDescr]struct{})
+	for _, v := range a {
+		found[v] = struct{}{}
+	}
+	for _, v := range b {
+		if _, ok := found[v]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ----------------------------------------
+// TEST-SOURCE-NODE
+
+const (
+	testnode_start = "start"
+	testnode_in    = "in"
+	testnode_cfg   = "cfg"
+	testnode_out   = "out"
+)
+
+// test_source_node is used solely in tests. It generates a value in the start and finishes.
+type test_source_node struct {
+	Items []interface{} `json:"items,omitempty"`
+}
+
+func (n *test_source_node) Describe() NodeDescr {
+	descr := NodeDescr{Id: "phly/test/source", Name: "Test Source", Purpose: "A source node for running tests."}
+	//	descr.InputPins = append(descr.InputPins, PinDescr{Name: testnode_in, Purpose: "Input."})
+	descr.OutputPins = append(descr.OutputPins, PinDescr{Name: testnode_out, Purpose: "Output."})
+	return descr
+}
+
+func (n *test_source_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_source_node{}, nil
+}
+
+func (n *test_source_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	fmt.Println("TEST NODE PROCESS", stage, "send", n.Items)
+	if len(n.Items) > 0 {
+		cmds := []interface{}{testnode_out}
+		cmds = append(cmds, n.Items...)
+		pins, err := BuildPins(cmds...)
+		if err != nil {
+			return err
+		}
+		output.SendPins(pins)
+	}
+	output.SendMsg(MsgFromStop(nil))
+	return nil
+}
+
+func (n *test_source_node) StopNode(args StoppedArgs) error {
+	fmt.Println("testing node stopped!")
+	return nil
+}
+
+// ----------------------------------------
+// TEST-TYPED-NODE
+
+// test_typed_node is used solely in tests. Its pins declare the MIME types
+// in its cfg, and it sends a single doc of type Send, if there is one.
+type test_typed_node struct {
+	Accepts  string `json:"accepts,omitempty"`
+	Produces string `json:"produces,omitempty"`
+	Send     string `json:"send,omitempty"`
+}
+
+func (n *test_typed_node) Describe() NodeDescr {
+	descr := NodeDescr{Id: "phly/test/typed", Name: "Test Typed", Purpose: "A node with typed pins for running tests."}
+	in := PinDescr{Name: testnode_in, Purpose: "Input."}
+	if n.Accepts != "" {
+		in.MimeTypes = []string{n.Accepts}
+	}
+	out := PinDescr{Name: testnode_out, Purpose: "Output."}
+	if n.Produces != "" {
+		out.MimeTypes = []string{n.Produces}
+	}
+	descr.InputPins = append(descr.InputPins, in)
+	descr.OutputPins = append(descr.OutputPins, out)
+	return descr
+}
+
+func (n *test_typed_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_typed_node{}, nil
+}
+
+func (n *test_typed_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	if n.Send != "" {
+		output.SendPins(PinBuilder{}.Add(testnode_out, &Doc{MimeType: n.Send, Items: []interface{}{"typed"}}).Pins())
+	}
+	output.SendMsg(MsgFromStop(nil))
+	return nil
+}
+
+func (n *test_typed_node) StopNode(args StoppedArgs) error {
+	return nil
+}
+
+// ----------------------------------------
+// TEST-PASS-NODE
+
+// test_pass_node is used solely in tests. It sends all input to its output.
+type test_pass_node struct {
+}
+
+func (n *test_pass_node) Describe() NodeDescr {
+	descr := NodeDescr{Id: "phly/test/pass", Name: "Test Pass", Purpose: "A passthrough node for running tests."}
+	descr.InputPins = append(descr.InputPins, PinDescr{Name: testnode_in, Purpose: "Input."})
+	descr.OutputPins = append(descr.OutputPins, PinDescr{Name: testnode_out, Purpose: "Output."})
+	return descr
+}
+
+func (n *test_pass_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_pass_node{}, nil
+}
+
+func (n *test_pass_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	if input != nil {
+		docs := input.GetPin(testnode_in)
+		if len(docs.Docs) > 0 {
+			output.SendPins(MustBuildPins(testnode_out, &docs))
+		}
+	}
+	output.SendMsg(MsgFromStop(nil))
+	return nil
+}
+
+func (n *test_pass_node) StopNode(args StoppedArgs) error {
+	return nil
+}
+
+// ----------------------------------------
+// TEST-JOIN-NODE
+
+const (
+	testnode_a = "a"
+	testnode_b = "b"
+)
+
+// test_join_node is used solely in tests. It waits for its startup
+// pins, sends them in order to its output, and finishes.
+type test_join_node struct {
+}
+
+func (n *test_join_node) Describe() NodeDescr {
+	descr := NodeDescr{Id: "phly/test/join", Name: "Test Join", Purpose: "A startup node for running tests."}
+	descr.StartupPins = append(descr.StartupPins, PinDescr{Name: testnode_a, Purpose: "Required input."})
+	descr.StartupPins = append(descr.StartupPins, PinDescr{Name: testnode_b, Purpose: "Optional input.", Optional: true})
+	descr.OutputPins = append(descr.OutputPins, PinDescr{Name: testnode_out, Purpose: "Output."})
+	return descr
+}
+
+func (n *test_join_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_join_node{}, nil
+}
+
+func (n *test_join_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	docs := input.GetPin(testnode_a)
+	docs.Docs = append(docs.Docs, input.GetPin(testnode_b).Docs...)
+	output.SendPins(MustBuildPins(testnode_out, &docs))
+	output.SendMsg(MsgFromStop(nil))
+	return nil
+}
+
+func (n *test_join_node) StopNode(args StoppedArgs) error {
+	return nil
+}
+
+// ----------------------------------------
+// TEST-WAIT-NODE
+
+// test_wait_node is used solely in tests. It runs until its context is cancelled.
+type test_wait_node struct {
+}
+
+func (n *test_wait_node) Describe() NodeDescr {
+	return NodeDescr{Id: "phly/test/wait", Name: "Test Wait", Purpose: "A node that runs until cancelled."}
+}
+
+func (n *test_wait_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_wait_node{}, nil
+}
+
+func (n *test_wait_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	ctx := args.Context()
+	go func() {
+		<-ctx.Done()
+		output.SendMsg(MsgFromStop(ctx.Err()))
+	}()
+	return nil
+}
+
+func (n *test_wait_node) StopNode(args StoppedArgs) error {
+	return nil
+}
+
+// ----------------------------------------
+// TEST-LATER-NODE
+
+// test_later_node is used solely in tests. It sends a value and stops
+// from its own goroutine, Wait milliseconds after Process has returned.
+type test_later_node struct {
+	Wait int `json:"wait,omitempty"`
+}
+
+func (n *test_later_node) Describe() NodeDescr {
+	descr := NodeDescr{Id: "phly/test/later", Name: "Test Later", Purpose: "A node that sends output after Process returns."}
+	descr.OutputPins = append(descr.OutputPins, PinDescr{Name: testnode_out, Purpose: "Output."})
+	return descr
+}
+
+func (n *test_later_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_later_node{}, nil
+}
+
+func (n *test_later_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	wait := n.Wait
+	if wait < 1 {
+		wait = 10
+	}
+	go func() {
+		time.Sleep(time.Duration(wait) * time.Millisecond)
+		output.SendPins(MustBuildPins(testnode_out, "later"))
+		output.SendMsg(MsgFromStop(nil))
+	}()
+	return nil
+}
+
+func (n *test_later_node) StopNode(args StoppedArgs) error {
+	return nil
+}
+
+// ----------------------------------------
+// TEST-FAIL-NODE
+
+// test_fail_node is used solely in tests. Process fails the first
+// Fails times it's called, then sends its input, or "ok" without
+// any, and finishes. StopNode takes StopWait milliseconds.
+type test_fail_node struct {
+	Fails    int `json:"fails,omitempty"`
+	StopWait int `json:"stopWait,omitempty"`
+	calls    int
+}
+
+func (n *test_fail_node) Describe() NodeDescr {
+	descr := NodeDescr{Id: "phly/test/fail", Name: "Test Fail", Purpose: "A node that fails for running tests."}
+	descr.StartupPins = append(descr.StartupPins, PinDescr{Name: testnode_cfg, Purpose: "Optional startup input.", Optional: true})
+	descr.InputPins = append(descr.InputPins, PinDescr{Name: testnode_in, Purpose: "Input."})
+	descr.OutputPins = append(descr.OutputPins, PinDescr{Name: testnode_out, Purpose: "Output."})
+	return descr
+}
+
+func (n *test_fail_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_fail_node{}, nil
+}
+
+func (n *test_fail_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	n.calls++
+	if n.calls <= n.Fails {
+		return errors.New("fail")
+	}
+	docs := Docs{}
+	if input != nil {
+		docs = input.GetPin(testnode_in)
+	}
+	if len(docs.Docs) > 0 {
+		output.SendPins(MustBuildPins(testnode_out, &docs))
+	} else {
+		output.SendPins(MustBuildPins(testnode_out, "ok"))
+	}
+	output.SendMsg(MsgFromStop(nil))
+	return nil
+}
+
+func (n *test_fail_node) StopNode(args StoppedArgs) error {
+	time.Sleep(time.Duration(n.StopWait) * time.Millisecond)
+	return nil
+}
+
+// ----------------------------------------
+// TEST-PANIC-NODE
+
+// test_panic_node is used solely in tests. It panics in Process or StopNode,
+// depending on In, and otherwise sends "ok" and finishes.
+type test_panic_node struct {
+	In string `json:"in,omitempty"`
+}
+
+func (n *test_panic_node) Describe() NodeDescr {
+	descr := NodeDescr{Id: "phly/test/panic", Name: "Test Panic", Purpose: "A node that panics for running tests."}
+	descr.OutputPins = append(descr.OutputPins, PinDescr{Name: testnode_out, Purpose: "Output."})
+	return descr
+}
+
+func (n *test_panic_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_panic_node{}, nil
+}
+
+func (n *test_panic_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	if n.In == "process" {
+		panic("test panic")
+	}
+	output.SendPins(MustBuildPins(testnode_out, "ok"))
+	output.SendMsg(MsgFromStop(nil))
+	return nil
+}
+
+func (n *test_panic_node) StopNode(args StoppedArgs) error {
+	if n.In == "stop" {
+		panic("test panic")
+	}
+	return nil
+}
+
+// ----------------------------------------
+// TEST-PAUSABLE-NODE
+
+// test_pausable_node is used solely in tests. It runs until stopped,
+// recording the pause and resume stages it receives.
+type test_pausable_node struct {
+	mutex  sync.Mutex
+	stages []NodeStage
+}
+
+func (n *test_pausable_node) Describe() NodeDescr {
+	return NodeDescr{Id: "phly/test/pausable", Name: "Test Pausable", Purpose: "A pausable node for running tests.", Pausable: true}
+}
+
+func (n *test_pausable_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_pausable_node{}, nil
+}
+
+func (n *test_pausable_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	if stage == NodePausing || stage == NodeResuming {
+		defer lock.Locker(&n.mutex).Unlock()
+		n.stages = append(n.stages, stage)
+	}
+	return nil
+}
+
+func (n *test_pausable_node) StopNode(args StoppedArgs) error {
+	return nil
+}
+
+func (n *test_pausable_node) getStages() []NodeStage {
+	defer lock.Locker(&n.mutex).Unlock()
+	return append([]NodeStage(nil), n.stages...)
+}
+
+// ----------------------------------------
+// TEST-WRITE-NODE
+
+var (
+	test_written []string
+)
+
+// test_write_node is used solely in tests. It pretends to write a file, the
+// way a node with side effects would, or plans to in a dry run.
+type test_write_node struct {
+	File string `json:"file,omitempty"`
+}
+
+func (n *test_write_node) Describe() NodeDescr {
+	descr := NodeDescr{Id: "phly/test/write", Name: "Test Write", Purpose: "A node with side effects for running tests."}
+	descr.InputPins = append(descr.InputPins, PinDescr{Name: testnode_in, Purpose: "Input."})
+	return descr
+}
+
+func (n *test_write_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_write_node{}, nil
+}
+
+func (n *test_write_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	if args.DryRun() {
+		args.PlanAction("write " + n.File)
+	} else {
+		test_written = append(test_written, n.File)
+	}
+	output.SendMsg(MsgFromStop(nil))
+	return nil
+}
+
+func (n *test_write_node) StopNode(args StoppedArgs) error {
+	return nil
+}
+
+// ----------------------------------------
+// TEST-BURST-NODE
+
+// test_burst_node is used solely in tests. Each time it runs, it sleeps for
+// Sleep milliseconds, sends Count items to its output, one at a time, and finishes.
+type test_burst_node struct {
+	Count int `json:"count,omitempty"`
+	Sleep int `json:"sleep,omitempty"`
+}
+
+func (n *test_burst_node) Describe() NodeDescr {
+	descr := NodeDescr{Id: "phly/test/burst", Name: "Test Burst", Purpose: "A node that sends separate items for running tests."}
+	descr.InputPins = append(descr.InputPins, PinDescr{Name: testnode_in, Purpose: "Input."})
+	descr.OutputPins = append(descr.OutputPins, PinDescr{Name: testnode_out, Purpose: "Output."})
+	return descr
+}
+
+func (n *test_burst_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_burst_node{}, nil
+}
+
+func (n *test_burst_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	time.Sleep(time.Duration(n.Sleep) * time.Millisecond)
+	for i := 0; i < n.Count; i++ {
+		output.SendPins(MustBuildPins(testnode_out, i))
+	}
+	output.SendMsg(MsgFromStop(nil))
+	return nil
+}
+
+func (n *test_burst_node) StopNode(args StoppedArgs) error {
+	return nil
+}
+
+// ----------------------------------------
+// TEST-BUSY-NODE
+
+var (
+	test_busy = test_busy_t{}
+)
+
+// test_busy_t counts the busy nodes.
+type test_busy_t struct {
+	mutex   sync.Mutex
+	active  int
+	max     int
+	barrier int // The number of busy nodes wait() waits for
+}
+
+func (t *test_busy_t) add(delta int) {
+	defer lock.Locker(&t.mutex).Unlock()
+	t.active += delta
+	if t.active > t.max {
+		t.max = t.active
+	}
+}
+
+// wait() waits until at least barrier nodes have been busy at once, or a
+// second has passed, so nodes that can run together are sure to overlap.
+func (t *test_busy_t) wait() {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if t.reached() {
+			return
+		}
+	}
+}
+
+func (t *test_busy_t) reached() bool {
+	defer lock.Locker(&t.mutex).Unlock()
+	return t.max >= t.barrier
+}
+
+// test_busy_node is used solely in tests. It spends time in Process, recording
+// the most nodes that were processing at once.
+type test_busy_node struct {
+}
+
+func (n *test_busy_node) Describe() NodeDescr {
+	return NodeDescr{Id: "phly/test/busy", Name: "Test Busy", Purpose: "A slow node for running tests."}
+}
+
+func (n *test_busy_node) Instantiate(args InstantiateArgs, cfg interface{}) (Node, error) {
+	return &test_busy_node{}, nil
+}
+
+func (n *test_busy_node) Process(args ProcessArgs, stage NodeStage, input Pins, output NodeOutput) error {
+	test_busy.add(1)
+	test_busy.wait()
+	time.Sleep(50 * time.Millisecond)
+	test_busy.add(-1)
+	output.SendMsg(MsgFromStop(nil))
+	return nil
+}
+
+func (n *test_busy_node) StopNode(args StoppedArgs) error {
+	return nil
+}
+
+// ----------------------------------------
+// CONST and VAR
+
+const (
+	// Search for 'Z' to see where the bad data is broken
+	testPipelineBadData1 = `{ "nodes": Z{ "test1": { "node": "phly/test/source", "cfg": { "runmode": "" } } } }`
+	testPipelineBadData2 = `{ "nodes": { "test1": { "node": "Zphly/test/source", "cfg": { "runmode": "" } } } }`
+
+	testPipelineData1 = `{
+	"nodes": {
+		"test1": {
+			"node": "phly/test/source",
+			"cfg": {
+				"runmode": "running",
+				"finish": ["finish"]
+			}
+		}
+	}
+}`
+
+	testPipelineOuts1 = `{
+	"outs": {
+		"out": [ "src:out" ]
+	},
+	"nodes": {
+		"src": { "node": "phly/test/source", "cfg": { "items": ["a", "b"] } }
+	}
+}`
+
+	testPipelineStartup1 = `{
+	"outs": {
+		"out": [ "join:out" ]
+	},
+	"nodes": {
+		"src1": { "node": "phly/test/source", "cfg": { "items": ["1"] }, "outs": { "out": "join:a" } },
+		"src2": { "node": "phly/test/source", "cfg": { "items": ["2"] }, "outs": { "out": "join:b" } },
+		"join": { "node": "phly/test/join" }
+	}
+}`
+
+	testPipelineStartup2 = `{
+	"outs": {
+		"out": [ "join:out" ]
+	},
+	"nodes": {
+		"src1": { "node": "phly/test/source", "cfg": { "items": ["1"] }, "outs": { "out": "join:a" } },
+		"join": { "node": "phly/test/join" }
+	}
+}`
+
+	testPipelineTimeout1 = `{
+	"timeout": "10ms",
+	"nodes": {
+		"wait": { "node": "phly/test/wait" }
+	}
+}`
+
+	testPipelineLater1 = `{
+	"outs": {
+		"out": [ "later:out" ]
+	},
+	"nodes": {
+		"later": { "node": "phly/test/later" }
+	}
+}`
+
+	testPipelineOnError1 = `{
+	"outs": { "out": [ "fail:out" ] },
+	"nodes": {
+		"fail": { "node": "phly/test/fail", "cfg": { "fails": 1 } }
+	}
+}`
+
+	testPipelineOnError2 = `{
+	"outs": { "out": [ "fail:out" ] },
+	"nodes": {
+		"fail": { "node": "phly/test/fail", "cfg": { "fails": 1 }, "onError": "continue" }
+	}
+}`
+
+	testPipelineOnError3 = `{
+	"outs": { "out": [ "fail:out" ] },
+	"nodes": {
+		"fail": { "node": "phly/test/fail", "cfg": { "fails": 2 }, "onError": { "policy": "retry", "count": 2, "backoff": "1ms" } }
+	}
+}`
+
+	testPipelineOnError4 = `{
+	"outs": { "out": [ "fail:out" ] },
+	"nodes": {
+		"fail": { "node": "phly/test/fail", "cfg": { "fails": 2 }, "onError": { "policy": "retry", "count": 1, "backoff": "1ms" } }
+	}
+}`
+
+	testPipelineOnError5 = `{
+	"outs": { "out": [ "fail:out" ], "err": [ "fail:error" ] },
+	"nodes": {
+		"fail": { "node": "phly/test/fail", "cfg": { "fails": 1 }, "onError": "route" }
+	}
+}`
+
+	// The node fails on its startup input and first input, and is
+	// replaced with its startup input for the second.
+	testPipelineOnError6 = `{
+	"args": { "strings": { "cfg": "c" } },
+	"outs": { "out": [ "fail:out" ] },
+	"nodes": {
+		"src1": { "node": "phly/test/source", "cfg": { "items": [ "a" ] }, "outs": { "out": "fail:in" } },
+		"src2": { "node": "phly/test/source", "cfg": { "items": [ "a" ] }, "outs": { "out": "fail:in" } },
+		"fail": { "node": "phly/test/fail", "cfg": { "fails": 2 }, "onError": "continue", "ins": { "cfg": "args:cfg" } }
+	}
+}`
+
+	testPipelinePanic1 = `{
+	"nodes": {
+		"panic": { "node": "phly/test/panic", "cfg": { "in": "process" } }
+	}
+}`
+
+	testPipelinePanic2 = `{
+	"nodes": {
+		"panic": { "node": "phly/test/panic", "cfg": { "in": "process" }, "onError": "continue" }
+	}
+}`
+
+	testPipelinePanic3 = `{
+	"outs": { "out": [ "panic:out" ] },
+	"nodes": {
+		"panic": { "node": "phly/test/panic", "cfg": { "in": "stop" } }
+	}
+}`
+
+	testPipelineStats1 = `{
+	"outs": { "out": [ "pass:out" ] },
+	"nodes": {
+		"src": { "node": "phly/test/source", "cfg": { "items": ["a", "b"] }, "outs": { "out": "pass:in" } },
+		"pass": { "node": "phly/test/pass" }
+	}
+}`
+
+	testPipelineQueueBlock1 = `{
+	"workers": 1,
+	"queue": { "capacity": 1 },
+	"outs": { "out": [ "pass:out" ] },
+	"nodes": {
+		"burst": { "node": "phly/test/burst", "cfg": { "count": 4 }, "outs": { "out": "pass:in" } },
+		"pass": { "node": "phly/test/pass" }
+	}
+}`
+
+	testPipelineQueueBlock2 = `{
+	"workers": 1,
+	"queue": { "capacity": 1 },
+	"nodes": {
+		"src": { "node": "phly/test/source", "cfg": { "items": ["a"] }, "outs": { "out": "burst:in" } },
+		"burst": { "node": "phly/test/burst", "cfg": { "count": 3 }, "maxIterations": 3, "outs": { "out": "burst:in" } }
+	}
+}`
+
+	testPipelineQueueBlock3 = `{
+	"workers": 1,
+	"timeout": "50ms",
+	"queue": { "capacity": 1 },
+	"nodes": {
+		"burst": { "node": "phly/test/burst", "cfg": { "count": 5 }, "outs": { "out": "slow:in" } },
+		"slow": { "node": "phly/test/burst", "cfg": { "sleep": 200 } }
+	}
+}`
+
+	testPipelinePause1 = `{
+	"workers": 4,
+	"nodes": {
+		"later": { "node": "phly/test/later", "cfg": { "wait": 100 }, "outs": { "out": "pass:in" } },
+		"pass": { "node": "phly/test/pass" },
+		"wait": { "node": "phly/test/pausable" }
+	}
+}`
+
+	testPipelineValidate1 = `{
+	"args": { "strings": { "file": "a.txt" } },
+	"ins": {
+		"in": [ "a:nope" ]
+	},
+	"outs": {
+		"out": [ "a:out", "missing:out" ]
+	},
+	"nodes": {
+		"src": { "node": "phly/test/source", "outs": { "out": [ "a:in", "j:b" ] } },
+		"a": { "node": "phly/test/pass", "ins": { "in": "args:nofile" } },
+		"c": { "node": "phly/test/pass", "outs": { "out": "missing:in" } },
+		"d": { "node": "phly/test/pass", "maxIterations": 2, "outs": { "out": "d:in" } },
+		"j": { "node": "phly/test/join" }
+	}
+}`
+
+	// A self loop that runs the pass node once for the source, then 3 more times.
+	testPipelineLoop1 = `{
+	"outs": {
+		"out": [ "a:out" ]
+	},
+	"nodes": {
+		"src": { "node": "phly/test/source", "cfg": { "items": [ "a" ] }, "outs": { "out": "a:in" } },
+		"a": { "node": "phly/test/pass", "maxIterations": 3, "outs": { "out": "a:in" } }
+	}
+}`
+
+	// A cycle with no limit
+	testPipelineLoop2 = `{
+	"nodes": {
+		"src": { "node": "phly/test/source", "outs": { "out": "a:in" } },
+		"a": { "node": "phly/test/pass", "outs": { "out": "b:in" } },
+		"b": { "node": "phly/test/pass", "outs": { "out": "a:in" } }
+	}
+}`
+
+	// A limit on a node outside the cycle
+	testPipelineLoop3 = `{
+	"nodes": {
+		"src": { "node": "phly/test/source", "maxIterations": 3, "outs": { "out": "a:in" } },
+		"a": { "node": "phly/test/pass", "outs": { "out": "b:in" } },
+		"b": { "node": "phly/test/pass", "outs": { "out": "a:in" } }
+	}
+}`
+
+	testPipelineLoop4 = `{
+	"nodes": {
+		"a": { "node": "phly/test/pass", "maxIterations": 0, "outs": { "out": "a:in" } }
+	}
+}`
+
+	// An image output connected to a wildcard image input
+	testPipelineTyped1 = `{
+	"nodes": {
+		"src": { "node": "phly/test/typed", "cfg": { "produces": "image/png" }, "outs": { "out": "dst:in" } },
+		"dst": { "node": "phly/test/typed", "cfg": { "accepts": "image/*" } }
+	}
+}`
+
+	// An image output connected to a text input
+	testPipelineTyped2 = `{
+	"nodes": {
+		"src": { "node": "phly/test/typed", "cfg": { "produces": "image/png" }, "outs": { "out": "dst:in" } },
+		"dst": { "node": "phly/test/typed", "cfg": { "accepts": "text/*" } }
+	}
+}`
+
+	// An untyped output that sends a doc the input accepts, ignoring the charset
+	testPipelineTyped3 = `{
+	"outs": {
+		"out": [ "dst:out" ]
+	},
+	"nodes": {
+		"src": { "node": "phly/test/typed", "cfg": { "send": "text/plain; charset=utf-8" }, "outs": { "out": "dst:in" } },
+		"dst": { "node": "phly/test/pass", "outs": { "out": "typed:in" } },
+		"typed": { "node": "phly/test/typed", "cfg": { "accepts": "text/plain" } }
+	}
+}`
+
+	// An untyped output that sends a doc the input doesn't accept
+	testPipelineTyped4 = `{
+	"nodes": {
+		"src": { "node": "phly/test/typed", "cfg": { "send": "image/png" }, "outs": { "out": "dst:in" } },
+		"dst": { "node": "phly/test/typed", "cfg": { "accepts": "text/*" } }
+	}
+}`
+
+	testPipelineEngine1 = `{
+	"nodes": {
+		"src": { "node": "phly/test/source" }
+	}
+}`
+
+	testPipelineCheckpoint1 = `{
+	"outs": {
+		"out": [ "pass:out" ]
+	},
+	"nodes": {
+		"src": { "node": "phly/test/source", "cfg": { "items": [ 1, "a" ] }, "outs": { "out": "pass:in" } },
+		"later": { "node": "phly/test/later", "cfg": { "wait": 300 }, "outs": { "out": "pass:in" } },
+		"pass": { "node": "phly/test/pass" }
+	}
+}`
+
+	// The fail node has input from src before its startup input from later.
+	testPipelineCheckpoint2 = `{
+	"outs": {
+		"out": [ "fail:out" ]
+	},
+	"nodes": {
+		"src": { "node": "phly/test/source", "cfg": { "items": [ "a" ] }, "outs": { "out": "fail:in" } },
+		"later": { "node": "phly/test/later", "cfg": { "wait": 300 }, "outs": { "out": "fail:cfg" } },
+		"fail": { "node": "phly/test/fail" }
+	}
+}`
+
+	// Run by the nested pipelines
+	testPipelineInnerPass1 = `{
+	"ins": { "in": [ "pass:in" ] },
+	"outs": { "out": [ "pass:out" ] },
+	"nodes": {
+		"pass": { "node": "phly/test/pass" }
+	}
+}`
+
+	testPipelineInnerFail1 = `{
+	"nodes": {
+		"fail": { "node": "phly/test/fail", "cfg": { "fails": 1 } }
+	}
+}`
+
+	// Input and output through a nested pipeline
+	testPipelineNested1 = `{
+	"outs": { "out": [ "nested:out" ] },
+	"nodes": {
+		"src": { "node": "phly/test/source", "cfg": { "items": [ "a", "b" ] }, "outs": { "out": "nested:in" } },
+		"nested": { "node": "phly/pipeline", "cfg": { "file": "${dir}/pass.json" } }
+	}
+}`
+
+	// Fails on its first input, and takes a while to stop
+	testPipelineInnerFailSlow1 = `{
+	"ins": { "in": [ "fail:in" ] },
+	"outs": { "out": [ "fail:out" ] },
+	"nodes": {
+		"fail": { "node": "phly/test/fail", "cfg": { "fails": 1, "stopWait": 200 } }
+	}
+}`
+
+	// A nested pipeline that fails the outer one
+	testPipelineNested2 = `{
+	"nodes": {
+		"nested": { "node": "phly/pipeline", "cfg": { "file": "${dir}/fail.json" } }
+	}
+}`
+
+	// A nested pipeline whose error is routed by the outer one
+	testPipelineNested3 = `{
+	"outs": { "err": [ "nested:error" ] },
+	"nodes": {
+		"nested": { "node": "phly/pipeline", "cfg": { "file": "${dir}/fail.json" }, "onError": "route" }
+	}
+}`
+
+	// A nested pipeline that receives input after its first run finished
+	testPipelineNested4 = `{
+	"outs": { "out": [ "nested:out" ] },
+	"nodes": {
+		"src": { "node": "phly/test/source", "cfg": { "items": [ "a" ] }, "outs": { "out": "nested:in" } },
+		"later": { "node": "phly/test/later", "cfg": { "wait": 50 }, "outs": { "out": "nested:in" } },
+		"nested": { "node": "phly/pipeline", "cfg": { "file": "${dir}/pass.json" } }
+	}
+}`
+
+	// A nested pipeline that receives input while its failed run is stopping
+	testPipelineNested5 = `{
+	"outs": { "out": [ "nested:out" ] },
+	"nodes": {
+		"src": { "node": "phly/test/source", "cfg": { "items": [ "a" ] }, "outs": { "out": "nested:in" } },
+		"later": { "node": "phly/test/later", "cfg": { "wait": 50 }, "outs": { "out": "nested:in" } },
+		"nested": { "node": "phly/pipeline", "cfg": { "file": "${dir}/failslow.json" }, "onError": "continue" }
+	}
+}`
+
+	testPipelineInnerArgs1 = `{
+	"args": { "strings": { "item": "inner" } },
+	"outs": { "out": [ "pass:out" ] },
+	"nodes": {
+		"pass": { "node": "phly/test/pass", "ins": { "in": "args:item" } }
+	}
+}`
+
+	// Nested pipelines with their default args, and args set by the cfg
+	testPipelineNestedArgs1 = `{
+	"outs": { "default": [ "default:out" ], "set": [ "set:out" ] },
+	"nodes": {
+		"default": { "node": "phly/pipeline", "cfg": { "file": "${dir}/args.json" } },
+		"set": { "node": "phly/pipeline", "cfg": { "file": "${dir}/args.json", "args": { "item": "outer" } } }
+	}
+}`
+
+	// A nested pipeline given an arg it doesn't declare
+	testPipelineNestedArgs2 = `{
+	"nodes": {
+		"nested": { "node": "phly/pipeline", "cfg": { "file": "${dir}/args.json", "args": { "size": 10 } } }
+	}
+}`
+	// A nested pipeline given an arg of the outer one
+	testPipelineNestedArgs3 = `{
+	"args": { "strings": { "w": "w" } },
+	"outs": { "out": [ "nested:out" ] },
+	"nodes": {
+		"nested": { "node": "phly/pipeline", "cfg": { "file": "${dir}/args.json", "args": { "item": "${w}-x" } } }
+	}
+}`
+
+	// Typed args, with defaults and allowed values
+	testPipelineTypedArgs1 = `{
+	"args": { "typed": {
+		"width": { "type": "int", "default": 100, "description": "Width in pixels" },
+		"tags": { "type": "list", "default": [ "a", "b" ] },
+		"mode": { "type": "enum", "values": [ "fit", "fill" ], "default": "fit" }
+	} },
+	"outs": { "w": [ "w:out" ], "t": [ "t:out" ], "m": [ "m:out" ] },
+	"nodes": {
+		"w": { "node": "phly/test/pass", "ins": { "in": "args:width" } },
+		"t": { "node": "phly/test/pass", "ins": { "in": "args:tags" } },
+		"m": { "node": "phly/test/pass", "ins": { "in": "args:mode" } }
+	}
+}`
+
+	// A required typed arg
+	testPipelineTypedArgs2 = `{
+	"args": { "typed": { "scale": { "type": "float", "required": true } } },
+	"outs": { "s": [ "s:out" ] },
+	"nodes": {
+		"s": { "node": "phly/test/pass", "ins": { "in": "args:scale" } }
+	}
+}`
+
+	// A default that isn't one of the allowed values
+	testPipelineTypedArgs3 = `{
+	"args": { "typed": { "mode": { "type": "enum", "values": [ "fit", "fill" ], "default": "stretch" } } },
+	"nodes": {
+		"m": { "node": "phly/test/pass", "ins": { "in": "args:mode" } }
+	}
+}`
+
+	// A string arg written as a number
+	testPipelineTypedArgs4 = `{
+	"args": { "strings": { "count": 4 } },
+	"outs": { "c": [ "c:out" ] },
+	"nodes": {
+		"c": { "node": "phly/test/pass", "ins": { "in": "args:count" } }
+	}
+}`
+
+	// A string arg that can't be a string
+	testPipelineTypedArgs5 = `{
+	"args": { "strings": { "count": { "value": 4 } } },
+	"nodes": {
+		"c": { "node": "phly/test/pass", "ins": { "in": "args:count" } }
+	}
+}`
+
+	// testPipelineLoop1 with comments and trailing commas
+	testPipelineJsonc1 = `{
+	// The source sends once, then a sends to itself
+	"outs": { "out": [ "a:out", ], },
+	"nodes": {
+		"src": { "node": "phly/test/source", "cfg": { "items": [ "a" ] }, "outs": { "out": "a:in" } },
+		/* Comments can include "quotes" and // */
+		"a": { "node": "phly/test/pass", "maxIterations": 3, "outs": { "out": "a:in" } },
+	},
+}`
+
+	// testPipelineLoop1 as yaml
+	testPipelineYaml1 = `# The source sends once, then a sends to itself
+outs:
+  out: [ "a:out" ]
+nodes:
+  src:
+    node: phly/test/source
+    cfg: { items: [ a ] }
+    outs: { out: "a:in" }
+  a:
+    node: phly/test/pass
+    maxIterations: 3
+    outs:
+      out:
+        - a:in
+`
+
+	testPipelineWrite1 = `{
+	"timeout": "1s",
+	"workers": "${cpus}",
+	"queue": { "capacity": 2 },
+	"args": { "env": "PHLY_", "strings": { "file": "a.txt" } },
+	"ins": { "in": [ "b:in" ] },
+	"outs": { "out": [ "b:out" ] },
+	"nodes": {
+		"a": { "node": "phly/test/pass", "queue": { "overflow": "drop_oldest" }, "onError": { "policy": "retry", "count": 2, "backoff": "10ms" }, "ins": { "in": "args:file" }, "outs": { "out": "b:in" } },
+		"b": { "node": "phly/test/pass" }
+	}
+}`
+
+	testPipelineDryRun1 = `{
+	"args": { "strings": { "file": "a.txt" } },
+	"nodes": {
+		"write": { "node": "phly/test/write", "cfg": { "file": "a.txt" }, "ins": { "in": "args:file" } }
+	}
+}`
+
+	// The plan shows the cfg with its vars replaced
+	testPipelineDryRun2 = `{
+	"nodes": {
+		"write": { "node": "phly/test/write", "cfg": { "file": "${os}.txt" } }
+	}
+}`
+
+	testPipelineWorkers1 = `{
+	"workers": 1,
+	"nodes": {
+		"a": { "node": "phly/test/busy" },
+		"b": { "node": "phly/test/busy" },
+		"c": { "node": "phly/test/busy" },
+		"d": { "node": "phly/test/busy" }
+	}
+}`
+
+	testPipelineWorkers4 = `{
+	"workers": "4",
+	"nodes": {
+		"a": { "node": "phly/test/busy" },
+		"b": { "node": "phly/test/busy" },
+		"c": { "node": "phly/test/busy" },
+		"d": { "node": "phly/test/busy" }
+	}
+}`
+
+	testPipelineFanOut1 = `{
+	"nodes": {
+		"src": { "node": "phly/test/source", "outs": { "out": "a:in" } },
+		"a": { "node": "phly/test/pass" }
+	}
+}`
+
+	testPipelineFanOut2 = `{
+	"nodes": {
+		"src": { "node": "phly/test/source", "outs": { "out": ["a:in", "b:in"] } },
+		"a": { "node": "phly/test/pass" },
+		"b": { "node": "phly/test/pass" }
+	}
+}`
+)
@@ -0,0 +1,274 @@
+package phly
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ----------------------------------------
+// VALIDATE-PROBLEM
+
+// ValidateProblem is a single problem found in a pipeline.
+type ValidateProblem struct {
+	Node    string // The node, or "ins" or "outs" for the pipeline's own pins
+	Pin     string // The pin, if the problem is with a pin
+	Msg     string
+	Warning bool // The pipeline runs, but probably not as intended
+}
+
+func (p ValidateProblem) String() string {
+	loc := p.Node
+	if p.Pin != "" {
+		loc += ":" + p.Pin
+	}
+	label := "error"
+	if p.Warning {
+		label = "warning"
+	}
+	return loc + ": " + label + ": " + p.Msg
+}
+
+// ----------------------------------------
+// VALIDATE-ERROR
+
+// ValidateError is answered when a pipeline has at least one problem
+// that isn't a warning. It includes every problem found, warnings too.
+type ValidateError struct {
+	Problems []ValidateProblem
+}
+
+func (e *ValidateError) ErrorCode() int {
+	return InvalidErrCode
+}
+
+func (e *ValidateError) Error() string {
+	label := "Invalid (" + strconv.Itoa(InvalidErrCode) + ")"
+	for _, p := range e.Problems {
+		label += "\n\t" + p.String()
+	}
+	return label
+}
+
+// ValidatePipeline() answers every problem in the named pipeline,
+// using the default engine. See Engine.ValidatePipeline().
+func ValidatePipeline(name string) ([]ValidateProblem, error) {
+	return defaultEngine.ValidatePipeline(name)
+}
+
+// ----------------------------------------
+// PIPELINE
+
+// validate() verifies that the graph is valid, answering a ValidateError
+// with every problem if any are errors. extra are problems found while
+// reading the pipeline.
+func (p *pipeline) validate(extra ...ValidateProblem) error {
+	problems := append(extra, p.problems()...)
+	sort.Sort(sortValidateProblems(problems))
+	for _, problem := range problems {
+		if !problem.Warning {
+			return &ValidateError{problems}
+		}
+	}
+	return nil
+}
+
+// problems() answers every problem in the graph.
+func (p *pipeline) problems() []ValidateProblem {
+	v := &validator{p: p, descrs: make(map[*container]NodeDescr)}
+	for _, n := range p.nodes {
+		v.descrs[n] = n.node.Describe()
+	}
+	v.validateNodes()
+	v.validatePipelinePins()
+	v.validateRunnable()
+	if cycle := p.validateLoops(); len(cycle) > 0 {
+		v.add(false, cycle[0], "", "Cycle "+strings.Join(cycle, " -> ")+" needs maxIterations on one of its nodes")
+	}
+	return v.problems
+}
+
+// ----------------------------------------
+// VALIDATOR
+
+type validator struct {
+	p        *pipeline
+	descrs   map[*container]NodeDescr
+	problems []ValidateProblem
+}
+
+func (v *validator) add(warning bool, node, pin, msg string) {
+	v.problems = append(v.problems, ValidateProblem{Node: node, Pin: pin, Msg: msg, Warning: warning})
+}
+
+// validateNodes() checks the connections to and from each node.
+func (v *validator) validateNodes() {
+	for _, n := range v.p.nodes {
+		descr := v.descrs[n]
+		for _, con := range n.inputs {
+			if con.dstNode == nil {
+				v.add(false, n.name, con.srcPin, "Input has no source")
+			} else if con.dstNode.name == args_container.name {
+				if _, ok := v.p.args.arg(con.dstPin); !ok {
+					v.add(false, n.name, con.srcPin, "Input from args:"+con.dstPin+", which isn't declared in args.strings or args.typed")
+				}
+			}
+		}
+		for _, con := range n.outputs {
+			// Output to the pipeline is collected by the runner, so there's no node to validate.
+			if con.dstNode != nil && con.dstNode.name == pipeline_container.name {
+				continue
+			}
+			if con.dstNode == nil || con.dstNode.node == nil {
+				v.add(false, n.name, con.srcPin, "Output has no destination")
+				continue
+			}
+			dst := con.dstNode.name + ":" + con.dstPin
+			if !v.hasOutput(n, con.srcPin) {
+				v.add(false, n.name, con.srcPin, "Output to "+dst+" is from a pin the node doesn't have")
+			}
+			if !v.hasInput(con.dstNode, con.dstPin) {
+				v.add(false, n.name, con.srcPin, "Output to "+dst+", which isn't an input")
+			}
+			out, in := descr.FindOutput(con.srcPin), v.findInput(con.dstNode, con.dstPin)
+			if out != nil && in != nil && !out.compatible(*in) {
+				v.add(false, n.name, con.srcPin, "Output to "+dst+" produces "+strings.Join(out.MimeTypes, ", ")+", but the input accepts "+strings.Join(in.MimeTypes, ", "))
+			}
+		}
+		for _, pin := range descr.StartupPins {
+			if !pin.Optional && !connectedInput(n, pin.Name) {
+				v.add(false, n.name, pin.Name, "Required startup pin isn't connected")
+			}
+		}
+		for _, pin := range descr.OutputPins {
+			if !connectedOutput(n, pin.Name) {
+				v.add(true, n.name, pin.Name, "Output isn't connected")
+			}
+		}
+	}
+}
+
+// validatePipelinePins() checks the pipeline's own ins and outs.
+func (v *validator) validatePipelinePins() {
+	for _, descr := range v.p.inputDescr {
+		for _, conn := range descr.connections {
+			n := v.p.nodes[conn.DstNode]
+			if n == nil {
+				v.add(false, "ins", descr.Name, "Connects to missing node "+conn.DstNode)
+			} else if !v.hasInput(n, conn.DstPin) {
+				v.add(false, "ins", descr.Name, "Connects to "+conn.DstNode+":"+conn.DstPin+", which isn't an input")
+			}
+		}
+	}
+	for _, descr := range v.p.outputDescr {
+		for _, conn := range descr.connections {
+			n := v.p.nodes[conn.DstNode]
+			if n == nil {
+				v.add(false, "outs", descr.Name, "Connects to missing node "+conn.DstNode)
+			} else if !v.hasOutput(n, conn.DstPin) {
+				v.add(false, "outs", descr.Name, "Connects to "+conn.DstNode+":"+conn.DstPin+", which isn't an output")
+			}
+		}
+	}
+}
+
+// validateRunnable() finds nodes that can never run, because no input
+// can reach them. Nodes run when they have no inputs, when they receive
+// input from the args or the pipeline, or when a node that runs sends to them.
+func (v *validator) validateRunnable() {
+	runnable := make(map[*container]struct{})
+	var pending []*container
+	for _, n := range v.p.nodes {
+		if len(n.inputs) < 1 {
+			pending = append(pending, n)
+		}
+		for _, con := range n.inputs {
+			if con.dstNode != nil && v.p.nodes[con.dstNode.name] != con.dstNode {
+				pending = append(pending, n)
+				break
+			}
+		}
+	}
+	for len(pending) > 0 {
+		n := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := runnable[n]; ok {
+			continue
+		}
+		runnable[n] = struct{}{}
+		for _, con := range n.outputs {
+			if con.dstNode != nil && v.p.nodes[con.dstNode.name] == con.dstNode {
+				pending = append(pending, con.dstNode)
+			}
+		}
+	}
+	for _, n := range v.p.nodes {
+		if _, ok := runnable[n]; !ok {
+			v.add(true, n.name, "", "Node can never run, since no input reaches it")
+		}
+	}
+}
+
+// hasInput() answers true if the node can receive on the pin.
+func (v *validator) hasInput(n *container, pin string) bool {
+	return v.findInput(n, pin) != nil
+}
+
+// findInput() answers the input or startup pin on the node.
+func (v *validator) findInput(n *container, pin string) *PinDescr {
+	d := v.descrs[n]
+	if found := d.FindInput(pin); found != nil {
+		return found
+	}
+	return d.FindStartup(pin)
+}
+
+// hasOutput() answers true if the node can send on the pin,
+// including the pin for routed errors.
+func (v *validator) hasOutput(n *container, pin string) bool {
+	d := v.descrs[n]
+	return d.FindOutput(pin) != nil || (n.onError.Policy == ErrorRoute && n.onError.Pin == pin)
+}
+
+// ----------------------------------------
+// MISC
+
+func connectedInput(n *container, pin string) bool {
+	for _, con := range n.inputs {
+		if con.srcPin == pin {
+			return true
+		}
+	}
+	return false
+}
+
+func connectedOutput(n *container, pin string) bool {
+	for _, con := range n.outputs {
+		if con.srcPin == pin {
+			return true
+		}
+	}
+	return false
+}
+
+// ----------------------------------------
+// SORT
+
+type sortValidateProblems []ValidateProblem
+
+func (s sortValidateProblems) Len() int {
+	return len(s)
+}
+func (s sortValidateProblems) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortValidateProblems) Less(i, j int) bool {
+	a := []string{s[i].Node, s[i].Pin, s[i].Msg}
+	b := []string{s[j].Node, s[j].Pin, s[j].Msg}
+	for k := range a {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package phly
+
+import (
+	"encoding/json"
+	"github.com/micro-go/lock"
+	"io"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------
+// TRACER
+
+// Tracer receives events as a pipeline runs. Events can arrive
+// from multiple goroutines, so implementations must be thread safe,
+// and they should return quickly, since the runner waits on them.
+type Tracer interface {
+	Trace(TraceEvent)
+}
+
+// ----------------------------------------
+// TRACE-EVENT
+
+type TraceWhat string
+
+const (
+	TraceNodeCreated      TraceWhat = "node_created"      // A node has been created in the running graph
+	TraceNodeStarted      TraceWhat = "node_started"      // A node received its startup pins
+	TracePinsRouted       TraceWhat = "pins_routed"       // A node output was routed to a destination
+	TraceNodeStopped      TraceWhat = "node_stopped"      // A node was removed from the running graph
+	TracePipelineFinished TraceWhat = "pipeline_finished" // The pipeline is done running
+	TraceNodeRetry        TraceWhat = "node_retry"        // A node's Process failed and will be retried
+	TracePipelinePaused   TraceWhat = "pipeline_paused"   // The pipeline stopped feeding nodes
+	TracePipelineResumed  TraceWhat = "pipeline_resumed"  // The pipeline started feeding nodes again
+	TraceLoopLimit        TraceWhat = "loop_limit"        // Output around a cycle was dropped at the node's maxIterations
+	TraceError            TraceWhat = "error"             // A node or the pipeline reported an error
+)
+
+// TraceEvent describes a single event in a running pipeline.
+// Fields that don't apply to the event are left empty.
+type TraceEvent struct {
+	What     TraceWhat
+	Time     time.Time
+	Pipeline int32  // Identifies the running pipeline, since nested pipelines share a tracer
+	Node     string // The node name
+	Pin      string // The source pin, for routed pins
+	DstNode  string // The destination node, for routed pins
+	DstPin   string // The destination pin, for routed pins
+	Docs     int    // The number of docs, for routed pins
+	Depth    int    // The depth of the destination edge after the pins arrived, for routed pins
+	Err      error
+}
+
+// ----------------------------------------
+// NULL-TRACER
+
+// nullTracer is the default tracer, which ignores all events.
+type nullTracer struct {
+}
+
+func (t nullTracer) Trace(e TraceEvent) {
+}
+
+// ----------------------------------------
+// JSON-TRACER
+
+// NewJsonTracer() answers a tracer that writes each event to w
+// as a single line of JSON.
+func NewJsonTracer(w io.Writer) Tracer {
+	return &jsonTracer{w: w}
+}
+
+type jsonTracer struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (t *jsonTracer) Trace(e TraceEvent) {
+	out := traceEventIo{What: e.What, Time: e.Time, Pipeline: e.Pipeline, Node: e.Node, Pin: e.Pin, DstNode: e.DstNode, DstPin: e.DstPin, Docs: e.Docs, Depth: e.Depth}
+	if e.Err != nil {
+		out.Err = e.Err.Error()
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return
+	}
+	defer lock.Locker(&t.mutex).Unlock()
+	t.w.Write(append(data, '\n'))
+}
+
+// traceEventIo is the serialized form of a TraceEvent.
+type traceEventIo struct {
+	What     TraceWhat `json:"what"`
+	Time     time.Time `json:"time"`
+	Pipeline int32     `json:"pipeline"`
+	Node     string    `json:"node,omitempty"`
+	Pin      string    `json:"pin,omitempty"`
+	DstNode  string    `json:"dstnode,omitempty"`
+	DstPin   string    `json:"dstpin,omitempty"`
+	Docs     int       `json:"docs,omitempty"`
+	Depth    int       `json:"depth,omitempty"`
+	Err      string    `json:"err,omitempty"`
+}
+
+// ----------------------------------------
+// MISC
+
+// tracerOrDefault() answers the tracer, or the null tracer if there isn't one.
+func tracerOrDefault(t Tracer) Tracer {
+	if t == nil {
+		return nullTracer{}
+	}
+	return t
+}